@@ -2,7 +2,9 @@ package account
 
 import (
 	"ZK-Rollup/signature"
+	"encoding/json"
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -23,6 +25,14 @@ func TestAccount(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, acc.PubKey.A.X, acc1.PubKey.A.X)
 
+	// balances of every token
+	for i := range acc.Balances {
+		acc.Balances[i].SetUint64(uint64(i + 1))
+	}
+	err = UnMarshal(&acc1, acc.Marshal())
+	assert.NoError(t, err)
+	assert.Equal(t, acc, acc1)
+
 	var acc2 Account
 	accBytes = []byte{1, 2}
 	err = UnMarshal(&acc2, accBytes)
@@ -31,3 +41,28 @@ func TestAccount(t *testing.T) {
 	assert.ErrorContains(t, err, "invalid bytes")
 
 }
+
+func TestAccountJSON(t *testing.T) {
+	_, pubKey := signature.GenerateKeys(1)
+	acc := Account{Index: 3, Nonce: 2, PubKey: pubKey}
+	for i := range acc.Balances {
+		acc.Balances[i].SetUint64(uint64(i * 666))
+	}
+
+	data, err := json.Marshal(acc)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"balances":["0","666","1332","1998"]`)
+
+	var decoded Account
+	assert.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, acc, decoded)
+
+	invalid := []string{
+		strings.Replace(string(data), `"0","666"`, `"666"`, 1),
+		strings.Replace(string(data), `"1998"`, `"-1"`, 1),
+		strings.Replace(string(data), `"address":"0x`, `"address":"0xff`, 1),
+	}
+	for _, s := range invalid {
+		assert.ErrorIs(t, json.Unmarshal([]byte(s), &decoded), ErrInvalidJSON, s)
+	}
+}
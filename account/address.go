@@ -0,0 +1,67 @@
+package account
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254/twistededwards/eddsa"
+)
+
+var ErrInvalidAddress = errors.New("invalid address")
+
+// address of an account, the compressed point of its pubkey (Y and the sign of X).
+// both coordinates are bound, so keys sharing an X coordinate ((X, Y) and (X, -Y)) have distinct addresses
+type Address [32]byte
+
+func AddressOf(pubKey eddsa.PublicKey) Address {
+	return Address(pubKey.A.Bytes())
+}
+
+func (acc *Account) Address() Address {
+	return AddressOf(acc.PubKey)
+}
+
+// pubkey of the address, the point should be on the curve and the encoding canonical.
+// SetBytes doesn't check the point, so it's checked here
+func (a Address) PubKey() (eddsa.PublicKey, error) {
+	var pubKey eddsa.PublicKey
+	if _, err := pubKey.A.SetBytes(a[:]); err != nil {
+		return eddsa.PublicKey{}, ErrInvalidAddress
+	}
+	if !pubKey.A.IsOnCurve() || pubKey.A.IsZero() || AddressOf(pubKey) != a {
+		return eddsa.PublicKey{}, ErrInvalidAddress
+	}
+	return pubKey, nil
+}
+
+// hex encoding with the 0x prefix
+func (a Address) String() string {
+	return "0x" + hex.EncodeToString(a[:])
+}
+
+func ParseAddress(s string) (Address, error) {
+	var a Address
+	b, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil || len(b) != len(a) {
+		return Address{}, ErrInvalidAddress
+	}
+	copy(a[:], b)
+	if _, err := a.PubKey(); err != nil {
+		return Address{}, err
+	}
+	return a, nil
+}
+
+func (a Address) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+func (a *Address) UnmarshalText(text []byte) error {
+	res, err := ParseAddress(string(text))
+	if err != nil {
+		return err
+	}
+	*a = res
+	return nil
+}
@@ -0,0 +1,38 @@
+package account
+
+import (
+	"ZK-Rollup/signature"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddress(t *testing.T) {
+	_, pubKey := signature.GenerateKeys(1)
+	addr := AddressOf(pubKey)
+
+	parsed, err := ParseAddress(addr.String())
+	assert.NoError(t, err)
+	assert.Equal(t, addr, parsed)
+
+	res, err := parsed.PubKey()
+	assert.NoError(t, err)
+	assert.True(t, res.A.Equal(&pubKey.A))
+
+	// (X, -Y) is on the curve too, same X coordinate but not the same address
+	mirrored := pubKey
+	mirrored.A.Y.Neg(&pubKey.A.Y)
+	assert.True(t, mirrored.A.IsOnCurve())
+	assert.NotEqual(t, addr, AddressOf(mirrored))
+
+	_, err = ParseAddress("0x1234")
+	assert.ErrorIs(t, err, ErrInvalidAddress)
+
+	// Y above the modulus, not a canonical encoding
+	var invalid Address
+	for i := range invalid {
+		invalid[i] = 0xff
+	}
+	_, err = invalid.PubKey()
+	assert.ErrorIs(t, err, ErrInvalidAddress)
+}
@@ -0,0 +1,167 @@
+package account
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+)
+
+// every field of an account is encoded in a chunk of 32 bytes,
+// so that the hash of the bytes is the hash of the field elements in the circuit
+const ChunkSize = 32
+
+// version of the account encoding
+type Version uint8
+
+const (
+	V1 Version = iota + 1 // index ∥ nonce ∥ balance ∥ pubkeyX ∥ pubkeyY, single asset
+	V2                    // index ∥ nonce ∥ balances (4 tokens) ∥ pubkeyX ∥ pubkeyY
+)
+
+var (
+	ErrUnknownVersion = errors.New("unknown account encoding version")
+	ErrInvalidLength  = errors.New("invalid bytes")
+	ErrNonZeroPadding = errors.New("non zero padding")
+	ErrNonCanonical   = errors.New("non canonical field element")
+	ErrTokenOverflow  = errors.New("balance of a token not supported by the encoding")
+)
+
+// layout of a version of the account encoding
+type Codec struct {
+	Version  Version
+	NbTokens int // number of balance slots
+}
+
+var codecs = map[Version]Codec{
+	V1: {Version: V1, NbTokens: 1},
+	V2: {Version: V2, NbTokens: 4},
+}
+
+// encoding of the accounts in the state
+var Current = codecs[V2]
+
+func init() {
+	if Current.NbTokens != NbTokens {
+		panic("current account encoding doesn't match NbTokens")
+	}
+}
+
+// codec of the version
+func CodecOf(v Version) (Codec, error) {
+	c, ok := codecs[v]
+	if !ok {
+		return Codec{}, fmt.Errorf("%w: %d", ErrUnknownVersion, v)
+	}
+	return c, nil
+}
+
+// size of an account in bytes
+func (c Codec) Size() int {
+	return ChunkSize * (4 + c.NbTokens)
+}
+
+func (c Codec) Encode(acc *Account) ([]byte, error) {
+	for i := c.NbTokens; i < NbTokens; i++ {
+		if !acc.Balances[i].IsZero() {
+			return nil, fmt.Errorf("%w: token-%d in version %d", ErrTokenOverflow, i, c.Version)
+		}
+	}
+
+	res := make([]byte, c.Size())
+
+	// index and nonce are 64 bits i.e 8 bytes, at the end of their 32 bytes chunk
+	binary.BigEndian.PutUint64(res[ChunkSize-8:], acc.Index)
+	binary.BigEndian.PutUint64(res[2*ChunkSize-8:], acc.Nonce)
+
+	for i := 0; i < c.NbTokens; i++ {
+		buf := acc.Balances[i].Bytes()
+		copy(res[(2+i)*ChunkSize:], buf[:])
+	}
+
+	buf := acc.PubKey.A.X.Bytes()
+	copy(res[(2+c.NbTokens)*ChunkSize:], buf[:])
+
+	buf = acc.PubKey.A.Y.Bytes()
+	copy(res[(3+c.NbTokens)*ChunkSize:], buf[:])
+
+	return res, nil
+}
+
+// decodes the account, only the canonical encoding is accepted:
+// zero padding above index and nonce, and field elements lower than the modulus
+func (c Codec) Decode(acc *Account, accBytes []byte) error {
+	if len(accBytes) != c.Size() {
+		return fmt.Errorf("%w: required %d bytes, but found %d bytes", ErrInvalidLength, c.Size(), len(accBytes))
+	}
+
+	var decoded Account
+	chunk := func(i int) []byte {
+		return accBytes[i*ChunkSize : (i+1)*ChunkSize]
+	}
+
+	var err error
+	if decoded.Index, err = decodeUint64(chunk(0)); err != nil {
+		return fmt.Errorf("index: %w", err)
+	}
+	if decoded.Nonce, err = decodeUint64(chunk(1)); err != nil {
+		return fmt.Errorf("nonce: %w", err)
+	}
+	for i := 0; i < c.NbTokens; i++ {
+		if err := decodeElement(&decoded.Balances[i], chunk(2+i)); err != nil {
+			return fmt.Errorf("balance of token-%d: %w", i, err)
+		}
+	}
+	if err := decodeElement(&decoded.PubKey.A.X, chunk(2+c.NbTokens)); err != nil {
+		return fmt.Errorf("pubkey X: %w", err)
+	}
+	if err := decodeElement(&decoded.PubKey.A.Y, chunk(3+c.NbTokens)); err != nil {
+		return fmt.Errorf("pubkey Y: %w", err)
+	}
+
+	*acc = decoded
+	return nil
+}
+
+// migrates the accounts encoded in the version from to the current encoding
+func Migrate(data []byte, from Version) ([]byte, error) {
+	c, err := CodecOf(from)
+	if err != nil {
+		return nil, err
+	}
+	if len(data)%c.Size() != 0 {
+		return nil, fmt.Errorf("%w: %d bytes is not a list of version %d accounts", ErrInvalidLength, len(data), from)
+	}
+
+	nbAccounts := len(data) / c.Size()
+	res := make([]byte, 0, nbAccounts*AccountSizeInBytes)
+	for i := 0; i < nbAccounts; i++ {
+		var acc Account
+		if err := c.Decode(&acc, data[i*c.Size():(i+1)*c.Size()]); err != nil {
+			return nil, fmt.Errorf("account-%d: %w", i, err)
+		}
+		accBytes, err := Current.Encode(&acc)
+		if err != nil {
+			return nil, fmt.Errorf("account-%d: %w", i, err)
+		}
+		res = append(res, accBytes...)
+	}
+
+	return res, nil
+}
+
+func decodeUint64(chunk []byte) (uint64, error) {
+	if !bytes.Equal(chunk[:ChunkSize-8], make([]byte, ChunkSize-8)) {
+		return 0, ErrNonZeroPadding
+	}
+	return binary.BigEndian.Uint64(chunk[ChunkSize-8:]), nil
+}
+
+func decodeElement(e *fr.Element, chunk []byte) error {
+	if err := e.SetBytesCanonical(chunk); err != nil {
+		return fmt.Errorf("%w: %s", ErrNonCanonical, err)
+	}
+	return nil
+}
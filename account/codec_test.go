@@ -0,0 +1,74 @@
+package account
+
+import (
+	"ZK-Rollup/signature"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStrictDecoding(t *testing.T) {
+	_, pubKey := signature.GenerateKeys(1)
+	acc := Account{Index: 3, Nonce: 7, PubKey: pubKey}
+	acc.Balances[1] = fr.NewElement(42)
+
+	accBytes := acc.Marshal()
+	assert.Len(t, accBytes, AccountSizeInBytes)
+
+	var decoded Account
+	assert.NoError(t, UnMarshal(&decoded, accBytes))
+	assert.Equal(t, acc, decoded)
+
+	// padding above the index
+	tampered := append([]byte{}, accBytes...)
+	tampered[0] = 1
+	assert.ErrorIs(t, UnMarshal(&decoded, tampered), ErrNonZeroPadding)
+
+	// balance equal to the modulus, which is the same element as 0
+	tampered = append([]byte{}, accBytes...)
+	modulus := fr.Modulus().FillBytes(make([]byte, ChunkSize))
+	copy(tampered[2*ChunkSize:], modulus)
+	assert.ErrorIs(t, UnMarshal(&decoded, tampered), ErrNonCanonical)
+
+	// failed decoding leaves the account unchanged
+	assert.Equal(t, acc, decoded)
+
+	_, err := CodecOf(Version(0))
+	assert.ErrorIs(t, err, ErrUnknownVersion)
+}
+
+func TestMigrate(t *testing.T) {
+	_, pubKey := signature.GenerateKeys(1)
+	v1, err := CodecOf(V1)
+	assert.NoError(t, err)
+
+	var data []byte
+	for i := uint64(0); i < 3; i++ {
+		acc := Account{Index: i, Nonce: i, PubKey: pubKey}
+		acc.Balances[0] = fr.NewElement(100 * i)
+		accBytes, err := v1.Encode(&acc)
+		assert.NoError(t, err)
+		assert.Len(t, accBytes, 160)
+		data = append(data, accBytes...)
+	}
+
+	migrated, err := Migrate(data, V1)
+	assert.NoError(t, err)
+	assert.Len(t, migrated, 3*AccountSizeInBytes)
+
+	// single asset balance is the balance of token 0
+	var acc Account
+	assert.NoError(t, UnMarshal(&acc, migrated[2*AccountSizeInBytes:]))
+	assert.Equal(t, uint64(2), acc.Index)
+	assert.Equal(t, fr.NewElement(200), acc.Balances[0])
+	assert.Equal(t, pubKey, acc.PubKey)
+
+	// accounts with other tokens don't fit in the old encoding
+	acc.Balances[1] = fr.NewElement(1)
+	_, err = v1.Encode(&acc)
+	assert.ErrorIs(t, err, ErrTokenOverflow)
+
+	_, err = Migrate(data[1:], V1)
+	assert.ErrorIs(t, err, ErrInvalidLength)
+}
@@ -0,0 +1,65 @@
+package account
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+)
+
+var ErrInvalidJSON = errors.New("invalid account")
+
+// json encoding of an account, the pubkey is the address, balances are decimal strings
+//
+//	{"index": 0, "nonce": 1, "balances": ["666", "0", "0", "0"], "address": "0x..."}
+type accountJSON struct {
+	Index    uint64   `json:"index"`
+	Nonce    uint64   `json:"nonce"`
+	Balances []string `json:"balances"` // balance of every token ID
+	Address  Address  `json:"address"`
+}
+
+func (acc Account) MarshalJSON() ([]byte, error) {
+	res := accountJSON{
+		Index:    acc.Index,
+		Nonce:    acc.Nonce,
+		Balances: make([]string, NbTokens),
+		Address:  acc.Address(),
+	}
+	for k := range acc.Balances {
+		res.Balances[k] = acc.Balances[k].Text(10)
+	}
+	return json.Marshal(res)
+}
+
+// every token has a balance, lower than the modulus. The address should be a valid point
+func (acc *Account) UnmarshalJSON(data []byte) error {
+	var res accountJSON
+	if err := json.Unmarshal(data, &res); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidJSON, err)
+	}
+	if len(res.Balances) != NbTokens {
+		return fmt.Errorf("%w: %d balances, there are %d tokens", ErrInvalidJSON, len(res.Balances), NbTokens)
+	}
+
+	var a Account
+	a.Index = res.Index
+	a.Nonce = res.Nonce
+	for k, s := range res.Balances {
+		var b big.Int
+		if _, ok := b.SetString(s, 10); !ok || b.Sign() < 0 || b.Cmp(fr.Modulus()) >= 0 {
+			return fmt.Errorf("%w: balance %q of token-%d", ErrInvalidJSON, s, k)
+		}
+		a.Balances[k].SetBigInt(&b)
+	}
+	pubKey, err := res.Address.PubKey()
+	if err != nil {
+		return fmt.Errorf("%w: address: %s", ErrInvalidJSON, err)
+	}
+	a.PubKey = pubKey
+
+	*acc = a
+	return nil
+}
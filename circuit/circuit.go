@@ -2,7 +2,12 @@ package circuit
 
 import (
 	"ZK-Rollup/account"
+	"ZK-Rollup/config"
+	"ZK-Rollup/modules/deposit"
+	"ZK-Rollup/modules/withdrawal"
+	"crypto/sha256"
 	"fmt"
+	"slices"
 
 	tedwards "github.com/consensys/gnark-crypto/ecc/twistededwards"
 	"github.com/consensys/gnark/frontend"
@@ -12,67 +17,197 @@ import (
 	"github.com/consensys/gnark/std/signature/eddsa"
 )
 
+// balances and amounts are bounded to BalanceBits bits,
+// so that additions and subtractions never wrap around the scalar field
+const BalanceBits = 128
+
+// type of the tx in a batch slot
 const (
-	NbAccounts = 16 //number of account; 2 ^ 4 = 16
-	// WARNING: Depth depends on NbAccounts, change it as per nbAccounts
-	Depth     = 5 // depth of merkle proof; above 4 + 1 for leaf
-	BatchSize = 1 // nbTrasfers to batch in one proof
+	TxTypeNoop       = iota // padding, leaves the state unchanged
+	TxTypeTransfer          // signed transfer
+	TxTypeDeposit           // new account in an empty leaf
+	TxTypeWithdrawal        // signed withdrawal, paid out on L1
 )
 
+// version of the constraints, bumped when they change for the same config
+// (new fields, tx types or checks)
+const Version = 1
+
+// hash of the config and of the layout of the circuit, tag of the compiled circuit & its keys
+func Hash(cfg config.Config) []byte {
+	layout := fmt.Sprintf("version=%d,nbTokens=%d,balanceBits=%d", Version, account.NbTokens, BalanceBits)
+	h := sha256.Sum256(append(cfg.Hash(), layout...))
+	return h[:]
+}
+
 type AccountConstraints struct {
-	Index   frontend.Variable
-	Nonce   frontend.Variable
-	Balance frontend.Variable
-	PubKey  eddsa.PublicKey
+	Index    frontend.Variable
+	Nonce    frontend.Variable
+	Balances [account.NbTokens]frontend.Variable
+	PubKey   eddsa.PublicKey
 }
 
 type TransferConstraints struct {
+	TokenID        frontend.Variable
 	Amount         frontend.Variable
+	Fee            frontend.Variable
 	Nonce          frontend.Variable
 	SenderPubKey   eddsa.PublicKey
 	ReceiverPubKey eddsa.PublicKey
 	Signature      eddsa.Signature
 }
 
+// account registered by a deposit, zero if the slot is not a deposit
+type DepositConstraints struct {
+	PubKey  eddsa.PublicKey
+	TokenID frontend.Variable
+	Amount  frontend.Variable
+}
+
+// withdrawal paid out on L1, zero if the slot is not a withdrawal
+type WithdrawalConstraints struct {
+	Recipient frontend.Variable
+	TokenID   frontend.Variable
+	Amount    frontend.Variable
+}
+
 // A circuit that checks if a transaction is valid or not
+//
+// every slice has one element per tx of the batch,
+// so the circuit should be built with NewCircuit before compiling
 type Circuit struct {
-	SenderAccountsBefore   [BatchSize]AccountConstraints
-	ReceiverAccountsBefore [BatchSize]AccountConstraints
-	SenderPubKeys          [BatchSize]eddsa.PublicKey
-
-	SenderAccountsAfter   [BatchSize]AccountConstraints
-	ReceiverAccountsAfter [BatchSize]AccountConstraints
-	ReceiverPubKeys       [BatchSize]eddsa.PublicKey
-
-	TransferTxs [BatchSize]TransferConstraints
-
-	MerkleProofsReceiverBefore [BatchSize]merkle.MerkleProof
-	MerkleProofsReceiverAfter  [BatchSize]merkle.MerkleProof
-	MerkleProofsSenderBefore   [BatchSize]merkle.MerkleProof
-	MerkleProofsSenderAfter    [BatchSize]merkle.MerkleProof
-
-	LeafReceiver [BatchSize]frontend.Variable
-	LeafSender   [BatchSize]frontend.Variable
-
-	RootHashesBefore [BatchSize]frontend.Variable `gnark:",public"`
-	RootHashesAfter  [BatchSize]frontend.Variable `gnark:",public"`
-}
-
-func NewCircuit() Circuit {
-	return Circuit{
-		SenderAccountsBefore:   [BatchSize]AccountConstraints{},
-		ReceiverAccountsBefore: [BatchSize]AccountConstraints{},
-		SenderPubKeys:          [BatchSize]eddsa.PublicKey{},
-		SenderAccountsAfter:    [BatchSize]AccountConstraints{},
-		ReceiverAccountsAfter:  [BatchSize]AccountConstraints{},
-		ReceiverPubKeys:        [BatchSize]eddsa.PublicKey{},
-		TransferTxs:            [BatchSize]TransferConstraints{},
-
-		LeafReceiver:     [BatchSize]frontend.Variable{},
-		LeafSender:       [BatchSize]frontend.Variable{},
-		RootHashesBefore: [BatchSize]frontend.Variable{},
-		RootHashesAfter:  [BatchSize]frontend.Variable{},
+	SenderAccountsBefore   []AccountConstraints
+	ReceiverAccountsBefore []AccountConstraints
+	SenderPubKeys          []eddsa.PublicKey
+
+	SenderAccountsAfter   []AccountConstraints
+	ReceiverAccountsAfter []AccountConstraints
+	ReceiverPubKeys       []eddsa.PublicKey
+
+	TxTypes     []frontend.Variable
+	TransferTxs []TransferConstraints
+
+	MerkleProofsReceiverBefore []merkle.MerkleProof
+	MerkleProofsReceiverAfter  []merkle.MerkleProof
+	MerkleProofsSenderBefore   []merkle.MerkleProof
+	MerkleProofsSenderAfter    []merkle.MerkleProof
+
+	LeafReceiver []frontend.Variable
+	LeafSender   []frontend.Variable
+
+	// state roots of every transfer in the batch:
+	// before -> (sender updated) -> intermediate -> (receiver updated) -> after
+	RootHashesBefore       []frontend.Variable
+	RootHashesIntermediate []frontend.Variable
+	RootHashesAfter        []frontend.Variable
+
+	// fees of the batch are credited to the operator account after the last tx:
+	// RootHashesAfter[last] -> (operator updated) -> RootHashAfter
+	Operator                  int `gnark:"-"` // index of the operator account, fixed by the config
+	OperatorAccountBefore     AccountConstraints
+	OperatorAccountAfter      AccountConstraints
+	MerkleProofOperatorBefore merkle.MerkleProof
+	MerkleProofOperatorAfter  merkle.MerkleProof
+
+	// state roots before and after the whole batch
+	RootHashBefore frontend.Variable `gnark:",public"`
+	RootHashAfter  frontend.Variable `gnark:",public"`
+
+	// deposits of the batch, one per slot
+	Deposits []DepositConstraints `gnark:",public"`
+
+	// withdrawals of the batch, one per slot, and the number of the batch they are paid out in
+	Withdrawals []WithdrawalConstraints `gnark:",public"`
+	BatchNumber frontend.Variable       `gnark:",public"`
+}
+
+// public inputs of a batch
+type PublicInputs struct {
+	RootHashBefore []byte
+	RootHashAfter  []byte
+	Deposits       []deposit.Deposit   // one per slot, zero if the slot is not a deposit
+	Withdrawals    []withdrawal.Record // one per slot, zero if the slot is not a withdrawal
+	BatchNumber    uint64
+}
+
+// circuit of the shape given by the config
+func NewCircuit(cfg config.Config) Circuit {
+	batchSize := cfg.BatchSize
+	circuit := Circuit{
+		SenderAccountsBefore:   make([]AccountConstraints, batchSize),
+		ReceiverAccountsBefore: make([]AccountConstraints, batchSize),
+		SenderPubKeys:          make([]eddsa.PublicKey, batchSize),
+		SenderAccountsAfter:    make([]AccountConstraints, batchSize),
+		ReceiverAccountsAfter:  make([]AccountConstraints, batchSize),
+		ReceiverPubKeys:        make([]eddsa.PublicKey, batchSize),
+		TxTypes:                make([]frontend.Variable, batchSize),
+		TransferTxs:            make([]TransferConstraints, batchSize),
+
+		MerkleProofsReceiverBefore: make([]merkle.MerkleProof, batchSize),
+		MerkleProofsReceiverAfter:  make([]merkle.MerkleProof, batchSize),
+		MerkleProofsSenderBefore:   make([]merkle.MerkleProof, batchSize),
+		MerkleProofsSenderAfter:    make([]merkle.MerkleProof, batchSize),
+
+		LeafReceiver:           make([]frontend.Variable, batchSize),
+		LeafSender:             make([]frontend.Variable, batchSize),
+		RootHashesBefore:       make([]frontend.Variable, batchSize),
+		RootHashesIntermediate: make([]frontend.Variable, batchSize),
+		RootHashesAfter:        make([]frontend.Variable, batchSize),
+		Deposits:               make([]DepositConstraints, batchSize),
+		Withdrawals:            make([]WithdrawalConstraints, batchSize),
+		Operator:               cfg.Operator,
+	}
+	circuit.SetMerklePaths(cfg.Depth)
+
+	return circuit
+}
+
+// number of txs in the batch
+func (circuit *Circuit) BatchSize() int {
+	return len(circuit.TxTypes)
+}
+
+// copy of the circuit which doesn't share the slices of the batch with the original
+func (circuit *Circuit) Clone() Circuit {
+	c := *circuit
+	c.SenderAccountsBefore = slices.Clone(circuit.SenderAccountsBefore)
+	c.ReceiverAccountsBefore = slices.Clone(circuit.ReceiverAccountsBefore)
+	c.SenderPubKeys = slices.Clone(circuit.SenderPubKeys)
+	c.SenderAccountsAfter = slices.Clone(circuit.SenderAccountsAfter)
+	c.ReceiverAccountsAfter = slices.Clone(circuit.ReceiverAccountsAfter)
+	c.ReceiverPubKeys = slices.Clone(circuit.ReceiverPubKeys)
+	c.TxTypes = slices.Clone(circuit.TxTypes)
+	c.TransferTxs = slices.Clone(circuit.TransferTxs)
+	c.MerkleProofsReceiverBefore = slices.Clone(circuit.MerkleProofsReceiverBefore)
+	c.MerkleProofsReceiverAfter = slices.Clone(circuit.MerkleProofsReceiverAfter)
+	c.MerkleProofsSenderBefore = slices.Clone(circuit.MerkleProofsSenderBefore)
+	c.MerkleProofsSenderAfter = slices.Clone(circuit.MerkleProofsSenderAfter)
+	c.LeafReceiver = slices.Clone(circuit.LeafReceiver)
+	c.LeafSender = slices.Clone(circuit.LeafSender)
+	c.RootHashesBefore = slices.Clone(circuit.RootHashesBefore)
+	c.RootHashesIntermediate = slices.Clone(circuit.RootHashesIntermediate)
+	c.RootHashesAfter = slices.Clone(circuit.RootHashesAfter)
+	c.Deposits = slices.Clone(circuit.Deposits)
+	c.Withdrawals = slices.Clone(circuit.Withdrawals)
+	return c
+}
+
+// assignment of the public inputs only, to build the public witness
+func NewPublicAssignment(p PublicInputs) Circuit {
+	circuit := Circuit{
+		RootHashBefore: p.RootHashBefore,
+		RootHashAfter:  p.RootHashAfter,
+		Deposits:       make([]DepositConstraints, len(p.Deposits)),
+		Withdrawals:    make([]WithdrawalConstraints, len(p.Withdrawals)),
+		BatchNumber:    p.BatchNumber,
+	}
+	for i, d := range p.Deposits {
+		circuit.SetDeposit(uint64(i), d)
 	}
+	for i, w := range p.Withdrawals {
+		circuit.SetWithdrawal(uint64(i), w)
+	}
+	return circuit
 }
 
 func (circuit *Circuit) Define(api frontend.API) error {
@@ -82,13 +217,35 @@ func (circuit *Circuit) Define(api frontend.API) error {
 		return err
 	}
 
-	for i := 0; i < BatchSize; i++ {
+	// check if the batch starts and ends at the public roots,
+	// the fees are credited on top of the root after the last tx
+	api.AssertIsEqual(circuit.RootHashBefore, circuit.RootHashesBefore[0])
+	api.AssertIsEqual(circuit.RootHashesAfter[circuit.BatchSize()-1], circuit.MerkleProofOperatorBefore.RootHash)
+	api.AssertIsEqual(circuit.RootHashAfter, circuit.MerkleProofOperatorAfter.RootHash)
+
+	// fees of the batch, per token
+	var fees [account.NbTokens]frontend.Variable
+	for k := range fees {
+		fees[k] = 0
+	}
+
+	for i := 0; i < circuit.BatchSize(); i++ {
+
+		// check if roots are chained between transfers
+		if i > 0 {
+			api.AssertIsEqual(circuit.RootHashesAfter[i-1], circuit.RootHashesBefore[i])
+		}
 
 		// check if roothashes match
-		api.AssertIsEqual(circuit.RootHashesBefore[i], circuit.MerkleProofsReceiverBefore[i].RootHash)
+		// sender is updated first, then receiver on top of the intermediate root
 		api.AssertIsEqual(circuit.RootHashesBefore[i], circuit.MerkleProofsSenderBefore[i].RootHash)
+		api.AssertIsEqual(circuit.RootHashesIntermediate[i], circuit.MerkleProofsSenderAfter[i].RootHash)
+		api.AssertIsEqual(circuit.RootHashesIntermediate[i], circuit.MerkleProofsReceiverBefore[i].RootHash)
 		api.AssertIsEqual(circuit.RootHashesAfter[i], circuit.MerkleProofsReceiverAfter[i].RootHash)
-		api.AssertIsEqual(circuit.RootHashesAfter[i], circuit.MerkleProofsSenderAfter[i].RootHash)
+
+		// check if only the updated leaf is changed between the roots
+		assertSameSiblings(api, circuit.MerkleProofsSenderBefore[i], circuit.MerkleProofsSenderAfter[i])
+		assertSameSiblings(api, circuit.MerkleProofsReceiverBefore[i], circuit.MerkleProofsReceiverAfter[i])
 
 		// check if the index is correct
 		api.AssertIsEqual(circuit.ReceiverAccountsBefore[i].Index, circuit.LeafReceiver[i])
@@ -102,52 +259,235 @@ func (circuit *Circuit) Define(api frontend.API) error {
 		circuit.MerkleProofsReceiverAfter[i].VerifyProof(api, &hFunc, circuit.LeafReceiver[i])
 		circuit.MerkleProofsSenderAfter[i].VerifyProof(api, &hFunc, circuit.LeafSender[i])
 
-		verifyAccountUpdated(api, circuit.SenderAccountsBefore[i], circuit.ReceiverAccountsBefore[i],
-			circuit.SenderAccountsAfter[i], circuit.ReceiverAccountsAfter[i], circuit.TransferTxs[i].Amount)
+		// check if the tx type is known
+		isNoop := api.IsZero(api.Sub(circuit.TxTypes[i], TxTypeNoop))
+		isTransfer := api.IsZero(api.Sub(circuit.TxTypes[i], TxTypeTransfer))
+		isDeposit := api.IsZero(api.Sub(circuit.TxTypes[i], TxTypeDeposit))
+		isWithdrawal := api.IsZero(api.Sub(circuit.TxTypes[i], TxTypeWithdrawal))
+		api.AssertIsEqual(api.Add(isNoop, isTransfer, isDeposit, isWithdrawal), 1)
+
+		// check if merkle leaves are the hashes of the accounts,
+		// the leaf of a deposit is empty before the tx
+		verifyAccountLeafOrEmpty(api, hFunc, circuit.ReceiverAccountsBefore[i], circuit.MerkleProofsReceiverBefore[i], isDeposit)
+		verifyAccountLeaf(api, hFunc, circuit.SenderAccountsBefore[i], circuit.MerkleProofsSenderBefore[i])
+		verifyAccountLeaf(api, hFunc, circuit.ReceiverAccountsAfter[i], circuit.MerkleProofsReceiverAfter[i])
+		verifyAccountLeaf(api, hFunc, circuit.SenderAccountsAfter[i], circuit.MerkleProofsSenderAfter[i])
+
+		// check if the token ID is known, only the balance of the token is updated
+		tokens := tokenSelectors(api, circuit.TransferTxs[i].TokenID)
 
-		err := VerifySignature(api, circuit.TransferTxs[i], hFunc)
+		verifyAccountUpdated(api, circuit.SenderAccountsBefore[i], circuit.ReceiverAccountsBefore[i],
+			circuit.SenderAccountsAfter[i], circuit.ReceiverAccountsAfter[i], circuit.TransferTxs[i], tokens, isTransfer,
+			circuit.Deposits[i], isDeposit, isWithdrawal)
+		verifyDeposit(api, circuit.TransferTxs[i], circuit.Deposits[i], isDeposit)
+		verifyWithdrawal(api, circuit.TransferTxs[i], circuit.Withdrawals[i], isWithdrawal)
+
+		// no-ops and deposits are not signed,
+		// withdrawals sign the recipient instead of the receiver account
+		msg := api.Select(isWithdrawal,
+			WithdrawalMessage(api, circuit.TransferTxs[i], circuit.Withdrawals[i], hFunc),
+			TransferMessage(api, circuit.TransferTxs[i], hFunc))
+		err := VerifySignature(api, circuit.TransferTxs[i], msg, hFunc, api.Add(isTransfer, isWithdrawal))
 		if err != nil {
 			return err
 		}
+
+		for k := range fees {
+			fees[k] = api.Add(fees[k], api.Mul(tokens[k], circuit.TransferTxs[i].Fee))
+		}
 	}
 
+	verifyFeesCredited(api, hFunc, circuit.OperatorAccountBefore, circuit.OperatorAccountAfter,
+		circuit.MerkleProofOperatorBefore, circuit.MerkleProofOperatorAfter, circuit.Operator, fees)
+
 	return nil
 }
 
+// check if the operator account is only credited with the fees of the batch
+func verifyFeesCredited(api frontend.API, hFunc mimc.MiMC,
+	before, after AccountConstraints, proofBefore, proofAfter merkle.MerkleProof,
+	operator int, fees [account.NbTokens]frontend.Variable) {
+
+	api.AssertIsEqual(before.Index, operator)
+	api.AssertIsEqual(after.Index, operator)
+	assertSameSiblings(api, proofBefore, proofAfter)
+	proofBefore.VerifyProof(api, &hFunc, operator)
+	proofAfter.VerifyProof(api, &hFunc, operator)
+	verifyAccountLeaf(api, hFunc, before, proofBefore)
+	verifyAccountLeaf(api, hFunc, after, proofAfter)
+
+	api.AssertIsEqual(before.Nonce, after.Nonce)
+	assertPubKeysEqual(api, before.PubKey, after.PubKey)
+
+	for k := range fees {
+		assertIsBalance(api, before.Balances[k])
+		assertIsBalance(api, after.Balances[k])
+		api.AssertIsEqual(api.Add(before.Balances[k], fees[k]), after.Balances[k])
+	}
+}
+
+// selectors of the token ID, tokens[k] is 1 if the token ID is k, 0 otherwise
+func tokenSelectors(api frontend.API, tokenID frontend.Variable) [account.NbTokens]frontend.Variable {
+	var tokens [account.NbTokens]frontend.Variable
+	for k := range tokens {
+		tokens[k] = api.IsZero(api.Sub(tokenID, k))
+	}
+	var sum frontend.Variable = 0
+	for k := range tokens {
+		sum = api.Add(sum, tokens[k])
+	}
+	api.AssertIsEqual(sum, 1)
+	return tokens
+}
+
+// hash of the account, same as the hash of account bytes
+// index ∥ nonce ∥ balances ∥ pubkeyX ∥ pubkeyY stored in the state
+func HashAccount(api frontend.API, acc AccountConstraints, hFunc mimc.MiMC) frontend.Variable {
+	hFunc.Reset()
+	hFunc.Write(acc.Index)
+	hFunc.Write(acc.Nonce)
+	hFunc.Write(acc.Balances[:]...)
+	hFunc.Write(acc.PubKey.A.X)
+	hFunc.Write(acc.PubKey.A.Y)
+
+	return hFunc.Sum()
+}
+
+// check if the leaf of merkle proof (Path[0]) is the hash of the account
+func verifyAccountLeaf(api frontend.API, hFunc mimc.MiMC, acc AccountConstraints, proof merkle.MerkleProof) {
+	accountHash := HashAccount(api, acc, hFunc)
+	api.AssertIsEqual(accountHash, proof.Path[0])
+}
+
+// same as verifyAccountLeaf, but the leaf should be empty (zero) if empty is 1
+func verifyAccountLeafOrEmpty(api frontend.API, hFunc mimc.MiMC, acc AccountConstraints, proof merkle.MerkleProof, empty frontend.Variable) {
+	accountHash := HashAccount(api, acc, hFunc)
+	api.AssertIsEqual(api.Select(empty, 0, accountHash), proof.Path[0])
+}
+
 func verifyAccountUpdated(api frontend.API,
 	fromBefore, toBefore, fromAfter, toAfter AccountConstraints,
-	amount frontend.Variable) {
-	// check if nonce updated correctly
-	nonceUpdated := api.Add(fromBefore.Nonce, 1)
+	t TransferConstraints, tokens [account.NbTokens]frontend.Variable, isTransfer frontend.Variable,
+	d DepositConstraints, isDeposit frontend.Variable, isWithdrawal frontend.Variable) {
+	amount := t.Amount
+	isSigned := api.Add(isTransfer, isWithdrawal)
+
+	// no-ops and deposits don't move any amount, only transfers pay a fee
+	api.AssertIsEqual(api.Mul(api.Sub(1, isSigned), amount), 0)
+	api.AssertIsEqual(api.Mul(api.Sub(1, isTransfer), t.Fee), 0)
+
+	// check if the transfer is signed by the sender and sent to the receiver
+	assertPubKeysEqual(api, t.SenderPubKey, fromBefore.PubKey)
+	assertPubKeysEqual(api, t.ReceiverPubKey, toBefore.PubKey)
+
+	// check if nonce updated correctly, no-ops and deposits don't update it
+	nonceUpdated := api.Add(fromBefore.Nonce, isSigned)
 	api.AssertIsEqual(nonceUpdated, fromAfter.Nonce)
 
-	// check if sender has enough balance
-	api.AssertIsLessOrEqual(amount, fromBefore.Balance)
+	// check if the transfer nonce is the next nonce of the sender (current nonce for no-ops)
+	api.AssertIsEqual(t.Nonce, fromAfter.Nonce)
+
+	// check if sender pubkey is unchanged
+	assertPubKeysEqual(api, fromBefore.PubKey, fromAfter.PubKey)
+
+	// check if receiver index, nonce and pubkey are unchanged,
+	// the receiver of a deposit is the new account with a zero nonce
+	api.AssertIsEqual(toBefore.Index, toAfter.Index)
+	api.AssertIsEqual(api.Select(isDeposit, 0, toBefore.Nonce), toAfter.Nonce)
+	api.AssertIsEqual(api.Select(isDeposit, d.PubKey.A.X, toBefore.PubKey.A.X), toAfter.PubKey.A.X)
+	api.AssertIsEqual(api.Select(isDeposit, d.PubKey.A.Y, toBefore.PubKey.A.Y), toAfter.PubKey.A.Y)
+
+	// check if amount and fee are in range
+	assertIsBalance(api, amount)
+	assertIsBalance(api, t.Fee)
+
+	for k := range tokens {
+		// check if balances are in range
+		assertIsBalance(api, fromBefore.Balances[k])
+		assertIsBalance(api, fromAfter.Balances[k])
+		assertIsBalance(api, toBefore.Balances[k])
+		assertIsBalance(api, toAfter.Balances[k])
+
+		// check if the amount and the fee are deducted from the sender balance of the token
+		// sender has enough balance, as fromAfter.Balances can't be negative (range checked)
+		senderAmountBeforeTx := api.Add(fromAfter.Balances[k], api.Mul(tokens[k], api.Add(amount, t.Fee)))
+		api.AssertIsEqual(senderAmountBeforeTx, fromBefore.Balances[k])
+
+		// check if the amount is added to the receiver balance of the token, withdrawn amounts leave the rollup,
+		// the balances of a new account are the deposited amount
+		credited := api.Mul(tokens[k], isTransfer, amount)
+		deposited := api.Mul(tokens[k], d.Amount)
+		receiverAmountUpdated := api.Select(isDeposit, deposited, api.Add(toBefore.Balances[k], credited))
+		api.AssertIsEqual(receiverAmountUpdated, toAfter.Balances[k])
+	}
+}
+
+// the deposit is in the token of the slot,
+// the deposit of a slot which is not a deposit should be zero
+func verifyDeposit(api frontend.API, t TransferConstraints, d DepositConstraints, isDeposit frontend.Variable) {
+	api.AssertIsEqual(api.Mul(isDeposit, t.TokenID), d.TokenID)
+
+	isNotDeposit := api.Sub(1, isDeposit)
+	api.AssertIsEqual(api.Mul(isNotDeposit, d.Amount), 0)
+	api.AssertIsEqual(api.Mul(isNotDeposit, d.PubKey.A.X), 0)
+	api.AssertIsEqual(api.Mul(isNotDeposit, d.PubKey.A.Y), 0)
+}
 
-	// check if the amount is deducted from sender
-	senderAmountBeforeTx := api.Add(fromAfter.Balance, amount)
-	api.AssertIsEqual(senderAmountBeforeTx, fromBefore.Balance)
+// check if both proofs have the same path above the leaf
+func assertSameSiblings(api frontend.API, before, after merkle.MerkleProof) {
+	for i := 1; i < len(before.Path); i++ {
+		api.AssertIsEqual(before.Path[i], after.Path[i])
+	}
+}
 
-	// check if the amount is added to the receiver
-	receiverAmountUpdated := api.Add(toBefore.Balance, amount)
-	api.AssertIsEqual(receiverAmountUpdated, toAfter.Balance)
+// check if the value fits in BalanceBits bits
+func assertIsBalance(api frontend.API, v frontend.Variable) {
+	api.ToBinary(v, BalanceBits)
+}
 
+func assertPubKeysEqual(api frontend.API, a, b eddsa.PublicKey) {
+	api.AssertIsEqual(a.A.X, b.A.X)
+	api.AssertIsEqual(a.A.Y, b.A.Y)
 }
 
-// verify the signature
-func VerifySignature(api frontend.API, t TransferConstraints, hFunc mimc.MiMC) error {
+// the withdrawn amount is paid out to the signed recipient,
+// the withdrawal of a slot which is not a withdrawal should be zero
+func verifyWithdrawal(api frontend.API, t TransferConstraints, w WithdrawalConstraints, isWithdrawal frontend.Variable) {
+	api.AssertIsEqual(api.Mul(isWithdrawal, t.TokenID), w.TokenID)
+	api.AssertIsEqual(api.Mul(isWithdrawal, t.Amount), w.Amount)
+	api.AssertIsEqual(api.Mul(api.Sub(1, isWithdrawal), w.Recipient), 0)
+}
 
+// same hash as transfer.Message
+func TransferMessage(api frontend.API, t TransferConstraints, hFunc mimc.MiMC) frontend.Variable {
 	hFunc.Reset()
 	hFunc.Write(t.Nonce)
+	hFunc.Write(t.TokenID)
 	hFunc.Write(t.Amount)
+	hFunc.Write(t.Fee)
 	hFunc.Write(t.SenderPubKey.A.X)
 	hFunc.Write(t.SenderPubKey.A.Y)
 	hFunc.Write(t.ReceiverPubKey.A.X)
 	hFunc.Write(t.ReceiverPubKey.A.Y)
 
-	txHash := hFunc.Sum()
+	return hFunc.Sum()
+}
+
+// same hash as withdrawal.Message
+func WithdrawalMessage(api frontend.API, t TransferConstraints, w WithdrawalConstraints, hFunc mimc.MiMC) frontend.Variable {
+	hFunc.Reset()
+	hFunc.Write(t.Nonce)
+	hFunc.Write(t.TokenID)
+	hFunc.Write(t.Amount)
+	hFunc.Write(t.SenderPubKey.A.X)
+	hFunc.Write(t.SenderPubKey.A.Y)
+	hFunc.Write(w.Recipient)
+
+	return hFunc.Sum()
+}
 
-	//txHash := []byte{1}
+// verify the signature of the message by the sender, if enabled is 1
+func VerifySignature(api frontend.API, t TransferConstraints, txHash frontend.Variable, hFunc mimc.MiMC, enabled frontend.Variable) error {
 
 	curve, err := twistededwards.NewEdCurve(api, tedwards.BN254)
 	if err != nil {
@@ -156,24 +496,15 @@ func VerifySignature(api frontend.API, t TransferConstraints, hFunc mimc.MiMC) e
 
 	hFunc.Reset()
 
-	return eddsa.Verify(curve, t.Signature, txHash, t.SenderPubKey, &hFunc)
+	return verifyEdDSAIf(curve, enabled, t.Signature, txHash, t.SenderPubKey, &hFunc)
 }
 
 func (circuit *Circuit) SetBeforeAccounts(index uint64, sender account.Account, receiver account.Account) {
 	circuit.LeafReceiver[index] = receiver.Index
 	circuit.LeafSender[index] = sender.Index
 
-	circuit.SenderAccountsBefore[index].Balance = sender.Balance
-	circuit.SenderAccountsBefore[index].Index = sender.Index
-	circuit.SenderAccountsBefore[index].Nonce = sender.Nonce
-	circuit.SenderAccountsBefore[index].PubKey.A.X = sender.PubKey.A.X
-	circuit.SenderAccountsBefore[index].PubKey.A.Y = sender.PubKey.A.Y
-
-	circuit.ReceiverAccountsBefore[index].Balance = receiver.Balance
-	circuit.ReceiverAccountsBefore[index].Index = receiver.Index
-	circuit.ReceiverAccountsBefore[index].Nonce = receiver.Nonce
-	circuit.ReceiverAccountsBefore[index].PubKey.A.X = receiver.PubKey.A.X
-	circuit.ReceiverAccountsBefore[index].PubKey.A.Y = receiver.PubKey.A.Y
+	setAccount(&circuit.SenderAccountsBefore[index], sender)
+	setAccount(&circuit.ReceiverAccountsBefore[index], receiver)
 
 	circuit.SenderPubKeys[index].A.X = sender.PubKey.A.X
 	circuit.SenderPubKeys[index].A.Y = sender.PubKey.A.Y
@@ -183,27 +514,48 @@ func (circuit *Circuit) SetBeforeAccounts(index uint64, sender account.Account,
 }
 
 func (circuit *Circuit) SetAfterAccounts(index uint64, sender account.Account, receiver account.Account) {
+	setAccount(&circuit.SenderAccountsAfter[index], sender)
+	setAccount(&circuit.ReceiverAccountsAfter[index], receiver)
+}
 
-	fmt.Println("sender", &sender.Balance, sender.Index, sender.Nonce, &receiver.Balance)
-	circuit.SenderAccountsAfter[index].Balance = sender.Balance
-	circuit.SenderAccountsAfter[index].Index = sender.Index
-	circuit.SenderAccountsAfter[index].Nonce = sender.Nonce
-	circuit.SenderAccountsAfter[index].PubKey.A.X = sender.PubKey.A.X
-	circuit.SenderAccountsAfter[index].PubKey.A.Y = sender.PubKey.A.Y
+// set the withdrawal of the slot, a zero withdrawal for the slots which are not withdrawals
+func (circuit *Circuit) SetWithdrawal(index uint64, w withdrawal.Record) {
+	circuit.Withdrawals[index].Recipient = w.Recipient
+	circuit.Withdrawals[index].TokenID = w.TokenID
+	circuit.Withdrawals[index].Amount = w.Amount
+}
 
-	circuit.ReceiverAccountsAfter[index].Balance = receiver.Balance
-	circuit.ReceiverAccountsAfter[index].Index = receiver.Index
-	circuit.ReceiverAccountsAfter[index].Nonce = receiver.Nonce
-	circuit.ReceiverAccountsAfter[index].PubKey.A.X = receiver.PubKey.A.X
-	circuit.ReceiverAccountsAfter[index].PubKey.A.Y = receiver.PubKey.A.Y
+// set the deposit of the slot, a zero deposit for the slots which are not deposits
+func (circuit *Circuit) SetDeposit(index uint64, d deposit.Deposit) {
+	circuit.Deposits[index].TokenID = d.TokenID
+	circuit.Deposits[index].Amount = d.Amount
+	circuit.Deposits[index].PubKey.A.X = d.PubKey.A.X
+	circuit.Deposits[index].PubKey.A.Y = d.PubKey.A.Y
+}
 
+// set the operator account before and after the fees of the batch are credited
+func (circuit *Circuit) SetOperatorAccounts(before account.Account, after account.Account) {
+	setAccount(&circuit.OperatorAccountBefore, before)
+	setAccount(&circuit.OperatorAccountAfter, after)
+}
+
+func setAccount(c *AccountConstraints, acc account.Account) {
+	c.Index = acc.Index
+	c.Nonce = acc.Nonce
+	for k := range acc.Balances {
+		c.Balances[k] = acc.Balances[k]
+	}
+	c.PubKey.A.X = acc.PubKey.A.X
+	c.PubKey.A.Y = acc.PubKey.A.Y
 }
 
-func (circuit *Circuit) SetMerklePaths() {
-	for i := 0; i < BatchSize; i++ {
-		circuit.MerkleProofsReceiverAfter[i].Path = make([]frontend.Variable, Depth)
-		circuit.MerkleProofsReceiverBefore[i].Path = make([]frontend.Variable, Depth)
-		circuit.MerkleProofsSenderAfter[i].Path = make([]frontend.Variable, Depth)
-		circuit.MerkleProofsSenderBefore[i].Path = make([]frontend.Variable, Depth)
+func (circuit *Circuit) SetMerklePaths(depth int) {
+	for i := 0; i < circuit.BatchSize(); i++ {
+		circuit.MerkleProofsReceiverAfter[i].Path = make([]frontend.Variable, depth)
+		circuit.MerkleProofsReceiverBefore[i].Path = make([]frontend.Variable, depth)
+		circuit.MerkleProofsSenderAfter[i].Path = make([]frontend.Variable, depth)
+		circuit.MerkleProofsSenderBefore[i].Path = make([]frontend.Variable, depth)
 	}
+	circuit.MerkleProofOperatorBefore.Path = make([]frontend.Variable, depth)
+	circuit.MerkleProofOperatorAfter.Path = make([]frontend.Variable, depth)
 }
@@ -0,0 +1,59 @@
+package circuit
+
+import (
+	"errors"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/algebra/native/twistededwards"
+	"github.com/consensys/gnark/std/hash"
+	"github.com/consensys/gnark/std/signature/eddsa"
+)
+
+// same as eddsa.Verify, but the signature is only enforced if enabled is 1
+// (enabled must be boolean). Used by the slots of a batch which carry no signed tx (no-ops).
+//
+// R and A should still be points on the curve when disabled, e.g. R = (0, 1) and A = any pubkey
+func verifyEdDSAIf(curve twistededwards.Curve, enabled frontend.Variable, sig eddsa.Signature,
+	msg frontend.Variable, pubKey eddsa.PublicKey, hash hash.FieldHasher) error {
+	api := curve.API()
+
+	// compute H(R, A, M)
+	hash.Write(sig.R.X)
+	hash.Write(sig.R.Y)
+	hash.Write(pubKey.A.X)
+	hash.Write(pubKey.A.Y)
+	hash.Write(msg)
+	hRAM := hash.Sum()
+
+	base := twistededwards.Point{
+		X: curve.Params().Base[0],
+		Y: curve.Params().Base[1],
+	}
+
+	//[S]G-[H(R,A,M)]*A
+	_A := curve.Neg(pubKey.A)
+	Q := curve.DoubleBaseScalarMul(base, _A, sig.S, hRAM)
+	curve.AssertIsOnCurve(Q)
+
+	//[S]G-[H(R,A,M)]*A-R
+	Q = curve.Add(curve.Neg(Q), sig.R)
+
+	// [cofactor]*(lhs-rhs)
+	if !curve.Params().Cofactor.IsUint64() {
+		return errors.New("invalid cofactor")
+	}
+	switch curve.Params().Cofactor.Uint64() {
+	case 4:
+		Q = curve.Double(curve.Double(Q))
+	case 8:
+		Q = curve.Double(curve.Double(curve.Double(Q)))
+	default:
+		return errors.New("curve cofactor is not implemented")
+	}
+
+	// Q should be the identity point (0, 1) if enabled
+	api.AssertIsEqual(api.Mul(enabled, Q.X), 0)
+	api.AssertIsEqual(api.Mul(enabled, api.Sub(Q.Y, 1)), 0)
+
+	return nil
+}
@@ -0,0 +1,44 @@
+package circuit
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark/backend/witness"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/schema"
+)
+
+var tVariable = reflect.TypeOf((*frontend.Variable)(nil)).Elem()
+
+// assigns the values of the full witness to the circuit, the circuit should have the shape of the witness.
+// Values are read in the order of frontend.NewWitness: the public ones first, then the secret ones
+func (circuit *Circuit) Assign(w witness.Witness) error {
+	vector, ok := w.Vector().(fr.Vector)
+	if !ok {
+		return fmt.Errorf("witness of another field")
+	}
+	count, err := schema.Walk(circuit, tVariable, nil)
+	if err != nil {
+		return err
+	}
+	if len(vector) != count.Public+count.Secret {
+		return fmt.Errorf("witness of %d values, the circuit has %d", len(vector), count.Public+count.Secret)
+	}
+
+	i := 0
+	for _, visibility := range []schema.Visibility{schema.Public, schema.Secret} {
+		_, err := schema.Walk(circuit, tVariable, func(leaf schema.LeafInfo, v reflect.Value) error {
+			if leaf.Visibility == visibility {
+				v.Set(reflect.ValueOf(vector[i]))
+				i++
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// subcommand of the rollup tool, run with the args after the command name
+type command struct {
+	usage string
+	run   func(args []string, stdout io.Writer) error
+}
+
+var commands = map[string]command{
+	"init":     {"write a genesis file & the keys of its accounts", runInit},
+	"keygen":   {"generate the key of an account", runKeygen},
+	"start":    {"run the node from a genesis file", runStart},
+	"send":     {"build and sign a transfer", runSend},
+	"prove":    {"execute signed transfers in a batch and write its proof file", runProve},
+	"verify":   {"check a proof file against a verifying key", runVerify},
+	"inspect":  {"dump the state root & accounts", runInspect},
+	"simulate": {"run the node with random transfers", runSimulate},
+}
+
+var ErrUsage = errors.New("usage")
+
+// runs the subcommand of the args, output is written to stdout
+func Run(args []string, stdout io.Writer) error {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		usage(stdout)
+		return nil
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		usage(os.Stderr)
+		return fmt.Errorf("%w: unknown command %q", ErrUsage, args[0])
+	}
+	return cmd.run(args[1:], stdout)
+}
+
+func usage(w io.Writer) {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(w, "usage: rollup <command> [flags]")
+	fmt.Fprintln(w)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-9s %s\n", name, commands[name].usage)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, `run "rollup <command> -h" for the flags of a command`)
+}
+
+// flags of the subcommand, errors are returned instead of exiting
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: rollup %s [flags]\n", name)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// flags that should be set
+func required(fs *flag.FlagSet, names ...string) error {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	var missing []string
+	for _, name := range names {
+		if !set[name] {
+			missing = append(missing, "-"+name)
+		}
+	}
+	if len(missing) != 0 {
+		return fmt.Errorf("%w: rollup %s requires %s", ErrUsage, fs.Name(), strings.Join(missing, ", "))
+	}
+	return nil
+}
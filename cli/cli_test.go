@@ -0,0 +1,113 @@
+package cli
+
+import (
+	"ZK-Rollup/account"
+	"ZK-Rollup/genesis"
+	"ZK-Rollup/modules/transfer"
+	"ZK-Rollup/signature"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr/mimc"
+	"github.com/stretchr/testify/assert"
+)
+
+func run(t *testing.T, args ...string) (string, error) {
+	var stdout bytes.Buffer
+	err := Run(args, &stdout)
+	return stdout.String(), err
+}
+
+func TestInitSendInspect(t *testing.T) {
+	dir := t.TempDir()
+	genesisFile := filepath.Join(dir, "genesis.json")
+	wallet := filepath.Join(dir, "wallet")
+
+	out, err := run(t, "init", "-out", genesisFile, "-wallet", wallet, "-accounts", "8", "-genesis-accounts", "3", "-chain", "7")
+	assert.NoError(t, err)
+	g, err := genesis.Load(genesisFile)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(7), g.ChainID)
+	assert.Len(t, g.Accounts, 3)
+	root, err := g.Root()
+	assert.NoError(t, err)
+	assert.Contains(t, out, "genesis state root")
+
+	// wallet keys are the keys of the genesis accounts
+	key, err := LoadKeyFile(filepath.Join(wallet, "account-1.json"))
+	assert.NoError(t, err)
+	assert.Equal(t, g.Accounts[1].PubKey, key.Address)
+
+	// keys are random unless the seeds of the simulation are asked for
+	_, seeded := signature.GenerateKeys(1)
+	assert.NotEqual(t, account.AddressOf(seeded), key.Address)
+	seededFile := filepath.Join(dir, "seeded.json")
+	_, err = run(t, "init", "-out", seededFile, "-wallet", filepath.Join(dir, "seeded"), "-accounts", "8", "-insecure-seed")
+	assert.NoError(t, err)
+	seededGenesis, err := genesis.Load(seededFile)
+	assert.NoError(t, err)
+	assert.Equal(t, account.AddressOf(seeded), seededGenesis.Accounts[1].PubKey)
+
+	txFile := filepath.Join(dir, "tx.json")
+	_, err = run(t, "send", "-key", filepath.Join(wallet, "account-1.json"), "-to", g.Accounts[2].PubKey.String(),
+		"-amount", "12", "-fee", "1", "-token", "2", "-nonce", "1", "-out", txFile)
+	assert.NoError(t, err)
+	data, err := os.ReadFile(txFile)
+	assert.NoError(t, err)
+	var tx transfer.Transfer
+	assert.NoError(t, json.Unmarshal(data, &tx))
+	assert.Equal(t, uint64(2), tx.TokenID)
+	verified, err := tx.VerifySignature(mimc.NewMiMC())
+	assert.NoError(t, err)
+	assert.True(t, verified)
+
+	// empty store, genesis state
+	out, err = run(t, "inspect", "-genesis", genesisFile, "-data", filepath.Join(dir, "data"), "-address", g.Accounts[2].PubKey.String())
+	assert.NoError(t, err)
+	assert.Contains(t, out, "batch: 0")
+	assert.Contains(t, out, "accounts: 3/8")
+	assert.Contains(t, out, "account-2")
+	assert.NotContains(t, out, "account-1")
+	assert.Contains(t, out, strings.TrimPrefix(g.Accounts[2].PubKey.String(), "0x"))
+	assert.Contains(t, out, fmt.Sprintf("state root: %x", root))
+}
+
+func TestKeygen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "key.json")
+	out, err := run(t, "keygen", "-out", path)
+	assert.NoError(t, err)
+
+	key, err := LoadKeyFile(path)
+	assert.NoError(t, err)
+	assert.Contains(t, out, key.Address.String())
+	_, err = key.Key()
+	assert.NoError(t, err)
+
+	// key of another address
+	other, err := run(t, "keygen", "-out", path, "-insecure-seed", "3")
+	assert.NoError(t, err)
+	assert.NotEqual(t, out, other)
+	tampered, err := LoadKeyFile(path)
+	assert.NoError(t, err)
+	tampered.Address = key.Address
+	_, err = tampered.Key()
+	assert.Error(t, err)
+}
+
+func TestUsage(t *testing.T) {
+	out, err := run(t)
+	assert.NoError(t, err)
+	assert.Contains(t, out, "inspect")
+
+	_, err = run(t, "unknown")
+	assert.ErrorIs(t, err, ErrUsage)
+	_, err = run(t, "send", "-amount", "1")
+	assert.ErrorIs(t, err, ErrUsage)
+	_, err = run(t, "prove")
+	assert.ErrorIs(t, err, ErrUsage)
+}
@@ -0,0 +1,452 @@
+package cli
+
+import (
+	"ZK-Rollup/account"
+	"ZK-Rollup/circuit"
+	"ZK-Rollup/config"
+	"ZK-Rollup/genesis"
+	"ZK-Rollup/modules/transfer"
+	"ZK-Rollup/node"
+	"ZK-Rollup/proofSystem"
+	"ZK-Rollup/rpc"
+	"ZK-Rollup/signature"
+	"ZK-Rollup/snapshot"
+	"ZK-Rollup/store"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr/mimc"
+	"github.com/consensys/gnark-crypto/ecc/bn254/twistededwards/eddsa"
+)
+
+// rollup init: genesis with random keys, or the deterministic keys of the simulation with -insecure-seed.
+// The key of every account is written into the wallet
+func runInit(args []string, stdout io.Writer) error {
+	fs := newFlagSet("init")
+	out := fs.String("out", "genesis.json", "genesis file")
+	wallet := fs.String("wallet", "wallet", "directory of the account keys")
+	nbAccounts := fs.Int("accounts", config.Default().NbAccounts, "capacity of the state, power of 2")
+	nbGenesis := fs.Int("genesis-accounts", 0, "number of genesis accounts, all the leaves if 0")
+	batchSize := fs.Int("batch", config.Default().BatchSize, "number of txs of a batch")
+	operator := fs.Int("operator", 0, "index of the operator account")
+	chainID := fs.Uint64("chain", 1, "chain ID")
+	insecureSeed := fs.Bool("insecure-seed", false, "deterministic keys of the simulation (account-i has the key of seed i), anyone can derive them")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg := config.New(*nbAccounts, *batchSize)
+	cfg.Operator = *operator
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	n := cfg.NbAccounts
+	if *nbGenesis > 0 && *nbGenesis < n {
+		n = *nbGenesis
+	}
+	privKeys := make([]eddsa.PrivateKey, n)
+	pubKeys := make([]eddsa.PublicKey, n)
+	for i := range privKeys {
+		seed := int64(-1)
+		if *insecureSeed {
+			seed = int64(i)
+		}
+		privKey, err := newKey(seed)
+		if err != nil {
+			return err
+		}
+		privKeys[i], pubKeys[i] = privKey, privKey.PublicKey
+	}
+	g := node.NewGenesis(cfg, *chainID, pubKeys)
+	if err := g.Validate(); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(*wallet, 0o700); err != nil {
+		return err
+	}
+	for i, privKey := range privKeys {
+		key := NewKeyFile(privKey)
+		if err := key.Save(filepath.Join(*wallet, fmt.Sprintf("account-%d.json", i))); err != nil {
+			return err
+		}
+	}
+	if err := g.Save(*out); err != nil {
+		return err
+	}
+
+	root, err := g.Root()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "genesis of %d accounts written to %s, keys in %s\n", len(g.Accounts), *out, *wallet)
+	fmt.Fprintf(stdout, "genesis state root: %x\n", root)
+	return nil
+}
+
+// rollup keygen: random key, or the deterministic key of the seed with -insecure-seed
+func runKeygen(args []string, stdout io.Writer) error {
+	fs := newFlagSet("keygen")
+	out := fs.String("out", "key.json", "key file")
+	seed := fs.Int64("insecure-seed", -1, "deterministic key of the seed (keys of the simulation), anyone can derive it. Random if negative")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	privKey, err := newKey(*seed)
+	if err != nil {
+		return err
+	}
+	key := NewKeyFile(privKey)
+	if err := key.Save(*out); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "address: %s\n", key.Address)
+	return nil
+}
+
+// rollup start: node from the genesis, or from its store if it was already started
+func runStart(args []string, stdout io.Writer) error {
+	fs := newFlagSet("start")
+	genesisFile := fs.String("genesis", "genesis.json", "genesis file")
+	dataDir := fs.String("data", node.DefaultDataDir, "directory of the node store")
+	keysDir := fs.String("keys", proofSystem.DefaultKeysDir, "directory of the circuit & keys")
+	rpcAddr := fs.String("rpc", "", "listen address of the JSON-RPC server (e.g. localhost:8545), disabled if empty")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	g, err := genesis.Load(*genesisFile)
+	if err != nil {
+		return err
+	}
+	n, st, err := node.StartNode(g, *dataDir, *keysDir)
+	if err != nil {
+		return err
+	}
+	if *rpcAddr != "" {
+		return rpc.NewServer(n, st).ListenAndServe(*rpcAddr)
+	}
+
+	// blocking call
+	select {}
+}
+
+// rollup send: signed transfer, in JSON. It's submitted to the node if -rpc is set
+func runSend(args []string, stdout io.Writer) error {
+	fs := newFlagSet("send")
+	keyFile := fs.String("key", "", "key file of the sender")
+	to := fs.String("to", "", "address of the receiver")
+	amount := fs.String("amount", "", "decimal amount")
+	fee := fs.String("fee", "0", "decimal fee, paid to the operator")
+	tokenID := fs.Uint64("token", 0, "token ID of the amount & the fee")
+	nonce := fs.Uint64("nonce", 0, "next nonce of the sender, asked to the node if -rpc is set")
+	out := fs.String("out", "", "transfer file (the submit result with -rpc), stdout if empty")
+	rpcURL := fs.String("rpc", "", "URL of the JSON-RPC server of the node (e.g. http://localhost:8545)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	flags := []string{"key", "to", "amount"}
+	if *rpcURL == "" {
+		flags = append(flags, "nonce")
+	}
+	if err := required(fs, flags...); err != nil {
+		return err
+	}
+	nonceSet := false
+	fs.Visit(func(f *flag.Flag) { nonceSet = nonceSet || f.Name == "nonce" })
+
+	key, err := LoadKeyFile(*keyFile)
+	if err != nil {
+		return err
+	}
+	privKey, err := key.Key()
+	if err != nil {
+		return err
+	}
+	receiver, err := account.ParseAddress(*to)
+	if err != nil {
+		return err
+	}
+	receiverPubKey, err := receiver.PubKey()
+	if err != nil {
+		return err
+	}
+
+	t := transfer.Transfer{
+		Nonce:          *nonce,
+		TokenID:        *tokenID,
+		SenderPubKey:   privKey.PublicKey,
+		ReceiverPubKey: receiverPubKey,
+	}
+	if t.Amount, err = transfer.ParseAmount(*amount); err != nil {
+		return err
+	}
+	if t.Fee, err = transfer.ParseAmount(*fee); err != nil {
+		return err
+	}
+	var client *rpc.Client
+	if *rpcURL != "" {
+		client = rpc.NewClient(*rpcURL)
+	}
+	if client != nil && !nonceSet {
+		var res rpc.GetNonceResult
+		if err := client.Call("getNonce", rpc.GetNonceParams{Address: key.Address}, &res); err != nil {
+			return err
+		}
+		t.Nonce = res.Nonce + 1
+	}
+	if err := t.SetSign(mimc.NewMiMC(), privKey); err != nil {
+		return err
+	}
+
+	var result any = t
+	if client != nil {
+		var res rpc.SubmitTransferResult
+		if err := client.Call("submitTransfer", t, &res); err != nil {
+			return err
+		}
+		result = res
+	}
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		_, err = fmt.Fprintln(stdout, string(data))
+		return err
+	}
+	return os.WriteFile(*out, append(data, '\n'), 0o644)
+}
+
+// rollup prove: the transfer files are executed in a batch on top of the state of the store
+// (the genesis if the store is empty), the state of the store isn't updated
+func runProve(args []string, stdout io.Writer) error {
+	fs := newFlagSet("prove")
+	genesisFile := fs.String("genesis", "genesis.json", "genesis file")
+	dataDir := fs.String("data", node.DefaultDataDir, "directory of the node store")
+	keysDir := fs.String("keys", proofSystem.DefaultKeysDir, "directory of the circuit & keys, generated if missing")
+	out := fs.String("out", "proof.json", "proof file")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: rollup prove [flags] transfer.json...")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return fmt.Errorf("%w: rollup prove requires transfer files", ErrUsage)
+	}
+
+	var txs []any
+	for _, path := range fs.Args() {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var t transfer.Transfer
+		if err := json.Unmarshal(data, &t); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		txs = append(txs, t)
+	}
+
+	g, err := genesis.Load(*genesisFile)
+	if err != nil {
+		return err
+	}
+	s, err := latestSnapshot(g, *dataDir)
+	if err != nil {
+		return err
+	}
+	n, err := node.NewNodeFromSnapshot(g.Params, s)
+	if err != nil {
+		return err
+	}
+
+	job, errs, err := n.ExecuteBatch(txs)
+	for i, txErr := range errs {
+		if txErr != nil {
+			fmt.Fprintf(stdout, "%s rejected: %s\n", fs.Arg(i), txErr)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if n.TxCount != uint64(len(txs)) {
+		return errors.New("transfers rejected, no proof written")
+	}
+
+	ps, err := proofSystem.LoadOrNew(*keysDir, g.Params)
+	if err != nil {
+		return err
+	}
+	proof, err := node.NewZkProver(ps).Prove(job)
+	if err != nil {
+		return err
+	}
+	f, err := proofSystem.NewProofFile(circuit.PublicInputs{
+		RootHashBefore: job.RootBefore,
+		RootHashAfter:  job.RootAfter,
+		Deposits:       job.Deposits,
+		Withdrawals:    job.Withdrawals,
+		BatchNumber:    job.BatchNumber,
+	}, proof.Proof)
+	if err != nil {
+		return err
+	}
+	if err := f.Save(*out); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(stdout, "proof of batch-%d written to %s\n", job.BatchNumber, *out)
+	fmt.Fprintf(stdout, "state root: %x -> %x\n", job.RootBefore, job.RootAfter)
+	return nil
+}
+
+// rollup verify: proof file against the verifying key of the genesis params
+func runVerify(args []string, stdout io.Writer) error {
+	fs := newFlagSet("verify")
+	genesisFile := fs.String("genesis", "genesis.json", "genesis file, params of the circuit")
+	keysDir := fs.String("keys", proofSystem.DefaultKeysDir, "directory of the verifying key")
+	proofFile := fs.String("proof", "proof.json", "proof file")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	g, err := genesis.Load(*genesisFile)
+	if err != nil {
+		return err
+	}
+	vk, err := proofSystem.LoadVerifyingKey(*keysDir, g.Params)
+	if err != nil {
+		return err
+	}
+	f, err := proofSystem.LoadProofFile(*proofFile)
+	if err != nil {
+		return err
+	}
+	if err := f.Verify(vk); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(stdout, "proof of batch-%d verified\n", f.BatchNumber)
+	fmt.Fprintf(stdout, "state root: %s -> %s\n", f.RootBefore, f.RootAfter)
+	return nil
+}
+
+// rollup inspect: state root of a batch & the accounts
+func runInspect(args []string, stdout io.Writer) error {
+	fs := newFlagSet("inspect")
+	genesisFile := fs.String("genesis", "genesis.json", "genesis file")
+	dataDir := fs.String("data", node.DefaultDataDir, "directory of the node store")
+	batch := fs.Int64("batch", -1, "committed batch, the last one if negative")
+	index := fs.Int64("account", -1, "index of the account to dump, all the accounts if negative")
+	address := fs.String("address", "", "address of the account to dump")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	g, err := genesis.Load(*genesisFile)
+	if err != nil {
+		return err
+	}
+	var s snapshot.Snapshot
+	if *batch < 0 {
+		s, err = latestSnapshot(g, *dataDir)
+	} else {
+		s, err = snapshotAt(g, *dataDir, uint64(*batch))
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(stdout, "batch: %d\n", s.BatchNumber)
+	fmt.Fprintf(stdout, "state root: %x\n", s.Root)
+	fmt.Fprintf(stdout, "accounts: %d/%d\n", s.NbAccounts(), g.Params.NbAccounts)
+
+	for i := 0; i < s.NbAccounts(); i++ {
+		var acc account.Account
+		if err := account.UnMarshal(&acc, s.Accounts[i*account.AccountSizeInBytes:(i+1)*account.AccountSizeInBytes]); err != nil {
+			return fmt.Errorf("account-%d: %w", i, err)
+		}
+		if *index >= 0 && acc.Index != uint64(*index) {
+			continue
+		}
+		if *address != "" && acc.Address().String() != *address {
+			continue
+		}
+		fmt.Fprintf(stdout, "\naccount-%d\n  address: %s\n  nonce: %d\n", acc.Index, acc.Address(), acc.Nonce)
+		for k := range acc.Balances {
+			fmt.Fprintf(stdout, "  token-%d: %s\n", k, acc.Balances[k].Text(10))
+		}
+	}
+	return nil
+}
+
+// rollup simulate: node of the default config with random transfers
+func runSimulate(args []string, stdout io.Writer) error {
+	fs := newFlagSet("simulate")
+	nbTransfers := fs.Uint64("transfers", 5, "number of random transfers")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	node.StartNodeWithRandomData(config.Default(), *nbTransfers)
+	return nil
+}
+
+// key from crypto/rand, or the deterministic key of the seed (signature.GenerateKeys, math/rand) if not negative
+func newKey(seed int64) (eddsa.PrivateKey, error) {
+	if seed >= 0 {
+		privKey, _ := signature.GenerateKeys(seed)
+		return privKey, nil
+	}
+	privKey, err := eddsa.GenerateKey(rand.Reader)
+	if err != nil {
+		return eddsa.PrivateKey{}, err
+	}
+	return *privKey, nil
+}
+
+// state at the last committed batch of the store, the genesis if the store is empty
+func latestSnapshot(g genesis.Genesis, dataDir string) (snapshot.Snapshot, error) {
+	st, err := store.OpenReadOnly(dataDir, g.Params)
+	if err != nil {
+		return snapshot.Snapshot{}, err
+	}
+	defer st.Close()
+
+	state, err := st.Recover()
+	if errors.Is(err, store.ErrEmpty) {
+		return g.Snapshot()
+	}
+	if err != nil {
+		return snapshot.Snapshot{}, err
+	}
+	return snapshot.Snapshot{
+		BatchNumber: state.BatchNumber,
+		Root:        state.Root(),
+		Accounts:    state.Accounts,
+	}, nil
+}
+
+// state after the committed batch of the store, batch 0 is the genesis
+func snapshotAt(g genesis.Genesis, dataDir string, batchNumber uint64) (snapshot.Snapshot, error) {
+	st, err := store.OpenReadOnly(dataDir, g.Params)
+	if err != nil {
+		return snapshot.Snapshot{}, err
+	}
+	defer st.Close()
+
+	s, err := snapshot.FromStore(st, batchNumber)
+	if errors.Is(err, store.ErrEmpty) && batchNumber == 0 {
+		return g.Snapshot()
+	}
+	return s, err
+}
@@ -0,0 +1,64 @@
+package cli
+
+import (
+	"ZK-Rollup/account"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254/twistededwards/eddsa"
+)
+
+// key of an account, in JSON
+//
+//	{"address": "0x...", "privateKey": "0x..."}
+type KeyFile struct {
+	Address    account.Address `json:"address"`
+	PrivateKey string          `json:"privateKey"` // binary encoding of the eddsa private key
+}
+
+func NewKeyFile(privKey eddsa.PrivateKey) KeyFile {
+	return KeyFile{
+		Address:    account.AddressOf(privKey.PublicKey),
+		PrivateKey: "0x" + hex.EncodeToString(privKey.Bytes()),
+	}
+}
+
+// private key of the file, its pubkey should be the address
+func (k *KeyFile) Key() (eddsa.PrivateKey, error) {
+	var privKey eddsa.PrivateKey
+	b, err := hex.DecodeString(strings.TrimPrefix(k.PrivateKey, "0x"))
+	if err != nil {
+		return privKey, fmt.Errorf("invalid private key: %w", err)
+	}
+	if _, err := privKey.SetBytes(b); err != nil {
+		return privKey, fmt.Errorf("invalid private key: %w", err)
+	}
+	if account.AddressOf(privKey.PublicKey) != k.Address {
+		return privKey, fmt.Errorf("private key of another address than %s", k.Address)
+	}
+	return privKey, nil
+}
+
+// key files are only readable by the owner
+func (k *KeyFile) Save(path string) error {
+	data, err := json.MarshalIndent(k, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o600)
+}
+
+func LoadKeyFile(path string) (KeyFile, error) {
+	var k KeyFile
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return k, err
+	}
+	if err := json.Unmarshal(data, &k); err != nil {
+		return k, fmt.Errorf("%s: %w", path, err)
+	}
+	return k, nil
+}
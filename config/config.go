@@ -0,0 +1,73 @@
+package config
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/bits"
+)
+
+// configuration of the rollup, the shape of the circuit, the state tree and
+// the node are all derived from it
+type Config struct {
+	NbAccounts int `json:"nbAccounts"` // capacity of the state, number of leaves of the state tree
+	Depth      int `json:"depth"`      // depth of merkle proofs; levels above the leaves + 1 for the leaf
+	BatchSize  int `json:"batchSize"`  // nbTransfers to batch in one proof
+	Operator   int `json:"operator"`   // index of the account credited with the fees of every batch
+}
+
+func Default() Config {
+	return Config{
+		NbAccounts: 16,
+		Depth:      5,
+		BatchSize:  4,
+	}
+}
+
+// config with the given capacity, the depth is derived from it
+func New(nbAccounts, batchSize int) Config {
+	return Config{
+		NbAccounts: nbAccounts,
+		Depth:      DepthOf(nbAccounts),
+		BatchSize:  batchSize,
+	}
+}
+
+// depth of the merkle proofs of a state with nbAccounts leaves (nbAccounts rounded up to a power of 2)
+func DepthOf(nbAccounts int) int {
+	if nbAccounts <= 1 {
+		return 1
+	}
+	return bits.Len(uint(nbAccounts-1)) + 1
+}
+
+// check if capacity, depth & batch size are consistent with each other
+func (c Config) Validate() error {
+	if c.NbAccounts < 2 {
+		return errors.New("invalid config: at least 2 accounts are required")
+	}
+	if c.NbAccounts&(c.NbAccounts-1) != 0 {
+		return fmt.Errorf("invalid config: nbAccounts %d should be a power of 2", c.NbAccounts)
+	}
+	if c.Depth != DepthOf(c.NbAccounts) {
+		return fmt.Errorf("invalid config: depth should be %d for %d accounts, found %d", DepthOf(c.NbAccounts), c.NbAccounts, c.Depth)
+	}
+	if c.BatchSize < 1 {
+		return errors.New("invalid config: batch size should be at least 1")
+	}
+	if c.Operator < 0 || c.Operator >= c.NbAccounts {
+		return fmt.Errorf("invalid config: operator account %d out of range", c.Operator)
+	}
+	return nil
+}
+
+// number of levels of the state tree above the leaves
+func (c Config) TreeDepth() int {
+	return c.Depth - 1
+}
+
+// hash of the circuit shape, keys are only valid for the shape they are generated with
+func (c Config) Hash() []byte {
+	h := sha256.Sum256([]byte(fmt.Sprintf("nbAccounts=%d,depth=%d,batchSize=%d,operator=%d", c.NbAccounts, c.Depth, c.BatchSize, c.Operator)))
+	return h[:]
+}
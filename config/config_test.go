@@ -0,0 +1,30 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, Default().Validate())
+	assert.Equal(t, Default(), New(16, 4))
+	assert.Equal(t, 21, New(1<<20, 4).Depth)
+
+	// depth doesn't match the capacity
+	cfg := Default()
+	cfg.Depth = 4
+	assert.ErrorContains(t, cfg.Validate(), "depth should be 5")
+
+	cfg = Default()
+	cfg.NbAccounts = 12
+	assert.ErrorContains(t, cfg.Validate(), "power of 2")
+
+	cfg = Default()
+	cfg.BatchSize = 0
+	assert.Error(t, cfg.Validate())
+
+	cfg = Default()
+	cfg.Operator = 16
+	assert.ErrorContains(t, cfg.Validate(), "operator")
+}
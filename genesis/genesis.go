@@ -0,0 +1,177 @@
+package genesis
+
+import (
+	"ZK-Rollup/account"
+	"ZK-Rollup/circuit"
+	"ZK-Rollup/config"
+	"ZK-Rollup/snapshot"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+)
+
+// Genesis of the rollup, read from a JSON file
+//
+//	{
+//	  "chainId": 1,
+//	  "params": {"nbAccounts": 16, "depth": 5, "batchSize": 4, "operator": 0},
+//	  "accounts": [{"pubKey": "0x...", "balances": ["666", "0"], "nonce": 0}, ...]
+//	}
+//
+// Accounts are registered in the order of the file, at index 0, 1, ...
+type Genesis struct {
+	ChainID  uint64        `json:"chainId"`  // id of the rollup
+	Params   config.Config `json:"params"`   // shape of the state tree & the circuit
+	Accounts []Account     `json:"accounts"` // accounts of the genesis state
+}
+
+type Account struct {
+	PubKey   account.Address `json:"pubKey"`   // compressed pubkey, hex
+	Balances []string        `json:"balances"` // decimal balance of every token ID, missing tokens are zero
+	Nonce    uint64          `json:"nonce"`
+}
+
+var ErrInvalidGenesis = errors.New("invalid genesis")
+
+// genesis entry of the account
+func AccountOf(acc account.Account) Account {
+	res := Account{
+		PubKey: acc.Address(),
+		Nonce:  acc.Nonce,
+	}
+	for k := range acc.Balances {
+		res.Balances = append(res.Balances, acc.Balances[k].Text(10))
+	}
+	return res
+}
+
+// checks the params, and that every account can be registered in the genesis state.
+// The first account (sender of no-ops & deposits) and the operator account should exist
+func (g *Genesis) Validate() error {
+	if g.ChainID == 0 {
+		return fmt.Errorf("%w: chain ID should not be zero", ErrInvalidGenesis)
+	}
+	if err := g.Params.Validate(); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidGenesis, err)
+	}
+	if len(g.Accounts) == 0 {
+		return fmt.Errorf("%w: no accounts", ErrInvalidGenesis)
+	}
+	if len(g.Accounts) > g.Params.NbAccounts {
+		return fmt.Errorf("%w: %d accounts, capacity is %d", ErrInvalidGenesis, len(g.Accounts), g.Params.NbAccounts)
+	}
+	if g.Params.Operator >= len(g.Accounts) {
+		return fmt.Errorf("%w: operator account %d doesn't exist", ErrInvalidGenesis, g.Params.Operator)
+	}
+
+	registered := make(map[account.Address]int)
+	for i, acc := range g.Accounts {
+		if _, err := acc.PubKey.PubKey(); err != nil {
+			return fmt.Errorf("%w: account-%d: %s", ErrInvalidGenesis, i, err)
+		}
+		if j, ok := registered[acc.PubKey]; ok {
+			return fmt.Errorf("%w: account-%d: pubkey of account-%d", ErrInvalidGenesis, i, j)
+		}
+		registered[acc.PubKey] = i
+
+		if _, err := acc.balances(); err != nil {
+			return fmt.Errorf("%w: account-%d: %s", ErrInvalidGenesis, i, err)
+		}
+	}
+	return nil
+}
+
+func (acc *Account) balances() ([account.NbTokens]fr.Element, error) {
+	var res [account.NbTokens]fr.Element
+	if len(acc.Balances) > account.NbTokens {
+		return res, fmt.Errorf("%d balances, there are %d tokens", len(acc.Balances), account.NbTokens)
+	}
+
+	for k, s := range acc.Balances {
+		var b big.Int
+		if _, ok := b.SetString(s, 10); !ok || b.Sign() < 0 {
+			return res, fmt.Errorf("invalid balance %q of token-%d", s, k)
+		}
+		if b.BitLen() > circuit.BalanceBits {
+			return res, fmt.Errorf("balance of token-%d out of range", k)
+		}
+		res[k].SetBigInt(&b)
+	}
+	return res, nil
+}
+
+// account bytes of the genesis state, the genesis should be valid
+func (g *Genesis) State() []byte {
+	state := make([]byte, 0, len(g.Accounts)*account.AccountSizeInBytes)
+	for i, acc := range g.Accounts {
+		pubKey, _ := acc.PubKey.PubKey()
+		balances, _ := acc.balances()
+		chainAccount := account.Account{
+			Index:    uint64(i),
+			Nonce:    acc.Nonce,
+			Balances: balances,
+			PubKey:   pubKey,
+		}
+		state = append(state, chainAccount.Marshal()...)
+	}
+	return state
+}
+
+// genesis state, the snapshot of batch 0
+func (g *Genesis) Snapshot() (snapshot.Snapshot, error) {
+	if err := g.Validate(); err != nil {
+		return snapshot.Snapshot{}, err
+	}
+	return snapshot.New(g.Params, 0, g.State())
+}
+
+// state root of the genesis
+func (g *Genesis) Root() ([]byte, error) {
+	s, err := g.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	return s.Root, nil
+}
+
+// strict decoding of the genesis file, unknown fields are refused
+func Decode(data []byte) (Genesis, error) {
+	var g Genesis
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.DisallowUnknownFields()
+	if err := d.Decode(&g); err != nil {
+		return Genesis{}, fmt.Errorf("%w: %s", ErrInvalidGenesis, err)
+	}
+	if d.More() {
+		return Genesis{}, fmt.Errorf("%w: trailing data", ErrInvalidGenesis)
+	}
+	if err := g.Validate(); err != nil {
+		return Genesis{}, err
+	}
+	return g, nil
+}
+
+func Load(path string) (Genesis, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Genesis{}, err
+	}
+	g, err := Decode(data)
+	if err != nil {
+		return Genesis{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return g, nil
+}
+
+func (g *Genesis) Save(path string) error {
+	data, err := json.MarshalIndent(g, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
@@ -0,0 +1,75 @@
+package genesis
+
+import (
+	"ZK-Rollup/account"
+	"ZK-Rollup/snapshot"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoad(t *testing.T) {
+	g, err := Load(filepath.Join("testdata", "genesis.json"))
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), g.ChainID)
+	assert.Equal(t, 4, g.Params.NbAccounts)
+
+	// accounts are registered in the order of the file, missing balances are zero
+	state := g.State()
+	assert.Len(t, state, 3*account.AccountSizeInBytes)
+	var acc account.Account
+	assert.NoError(t, account.UnMarshal(&acc, state[2*account.AccountSizeInBytes:]))
+	assert.Equal(t, uint64(2), acc.Index)
+	assert.Equal(t, g.Accounts[2].PubKey, acc.Address())
+	assert.Equal(t, "25", acc.Balances[1].String())
+	assert.True(t, acc.Balances[3].IsZero())
+	assert.NoError(t, account.UnMarshal(&acc, state[account.AccountSizeInBytes:2*account.AccountSizeInBytes]))
+	assert.Equal(t, g.Accounts[1], AccountOf(acc))
+
+	s, err := g.Snapshot()
+	assert.NoError(t, err)
+	root, err := snapshot.Root(g.Params, state)
+	assert.NoError(t, err)
+	assert.Equal(t, root, s.Root)
+
+	// same genesis after saving it
+	path := filepath.Join(t.TempDir(), "genesis.json")
+	assert.NoError(t, g.Save(path))
+	saved, err := Load(path)
+	assert.NoError(t, err)
+	assert.Equal(t, g, saved)
+}
+
+func TestValidate(t *testing.T) {
+	var invalidAddress account.Address
+	for i := range invalidAddress {
+		invalidAddress[i] = 0xff
+	}
+
+	valid, err := Load(filepath.Join("testdata", "genesis.json"))
+	assert.NoError(t, err)
+
+	invalid := map[string]func(g *Genesis){
+		"chain ID":        func(g *Genesis) { g.ChainID = 0 },
+		"params":          func(g *Genesis) { g.Params.Depth = 4 },
+		"no accounts":     func(g *Genesis) { g.Accounts = nil },
+		"operator":        func(g *Genesis) { g.Params.Operator = 3 },
+		"duplicate":       func(g *Genesis) { g.Accounts[2].PubKey = g.Accounts[0].PubKey },
+		"balance":         func(g *Genesis) { g.Accounts[1].Balances = []string{"-1"} },
+		"balance range":   func(g *Genesis) { g.Accounts[1].Balances = []string{"340282366920938463463374607431768211456"} },
+		"nb tokens":       func(g *Genesis) { g.Accounts[1].Balances = []string{"1", "2", "3", "4", "5"} },
+		"invalid address": func(g *Genesis) { g.Accounts[1].PubKey = invalidAddress },
+	}
+	for name, tamper := range invalid {
+		g := valid
+		g.Accounts = append([]Account{}, valid.Accounts...)
+		tamper(&g)
+		assert.ErrorIs(t, g.Validate(), ErrInvalidGenesis, name)
+	}
+
+	_, err = Decode([]byte(`{"chainId": 1, "unknown": 2}`))
+	assert.ErrorIs(t, err, ErrInvalidGenesis)
+	_, err = Decode([]byte(`{"chainId": 1, "accounts": [{"pubKey": "0x12"}]}`))
+	assert.ErrorIs(t, err, ErrInvalidGenesis)
+}
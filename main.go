@@ -1,10 +1,20 @@
 package main
 
 import (
-	"ZK-Rollup/circuit"
-	"ZK-Rollup/node"
+	"ZK-Rollup/cli"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
 )
 
 func main() {
-	node.StartNodeWithRandomData(circuit.NbAccounts, circuit.Depth)
+	err := cli.Run(os.Args[1:], os.Stdout)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 }
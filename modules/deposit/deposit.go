@@ -0,0 +1,22 @@
+package deposit
+
+import (
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark-crypto/ecc/bn254/twistededwards/eddsa"
+)
+
+// registers a new account with an initial balance in the next empty leaf of the state.
+// deposits are not signed, they are public inputs of the batch proof
+type Deposit struct {
+	PubKey  eddsa.PublicKey
+	TokenID uint64 // asset of the initial balance
+	Amount  fr.Element
+}
+
+func NewDeposit(amount uint64, pubKey eddsa.PublicKey) Deposit {
+	var d Deposit
+	d.Amount.SetUint64(amount)
+	d.PubKey = pubKey
+
+	return d
+}
@@ -0,0 +1,88 @@
+package transfer
+
+import (
+	"ZK-Rollup/account"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+)
+
+var ErrInvalidJSON = errors.New("invalid transfer")
+
+// json encoding of a transfer, pubkeys are addresses, amounts are decimal strings
+//
+//	{"nonce": 1, "tokenId": 0, "amount": "12", "fee": "1", "from": "0x...", "to": "0x...", "signature": "0x..."}
+type transferJSON struct {
+	Nonce     uint64          `json:"nonce"`
+	TokenID   uint64          `json:"tokenId"`
+	Amount    string          `json:"amount"`
+	Fee       string          `json:"fee"`
+	From      account.Address `json:"from"`
+	To        account.Address `json:"to"`
+	Signature string          `json:"signature"`
+}
+
+func (t Transfer) MarshalJSON() ([]byte, error) {
+	return json.Marshal(transferJSON{
+		Nonce:     t.Nonce,
+		TokenID:   t.TokenID,
+		Amount:    t.Amount.Text(10),
+		Fee:       t.Fee.Text(10),
+		From:      account.AddressOf(t.SenderPubKey),
+		To:        account.AddressOf(t.ReceiverPubKey),
+		Signature: "0x" + hex.EncodeToString(t.Signature.Bytes()),
+	})
+}
+
+// amounts should be canonical field elements, pubkeys & the signature point valid points.
+// the signature itself is verified by the node
+func (t *Transfer) UnmarshalJSON(data []byte) error {
+	var res transferJSON
+	if err := json.Unmarshal(data, &res); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidJSON, err)
+	}
+
+	var tx Transfer
+	var err error
+	tx.Nonce = res.Nonce
+	tx.TokenID = res.TokenID
+	if tx.Amount, err = ParseAmount(res.Amount); err != nil {
+		return fmt.Errorf("%w: amount: %s", ErrInvalidJSON, err)
+	}
+	if tx.Fee, err = ParseAmount(res.Fee); err != nil {
+		return fmt.Errorf("%w: fee: %s", ErrInvalidJSON, err)
+	}
+	if tx.SenderPubKey, err = res.From.PubKey(); err != nil {
+		return fmt.Errorf("%w: from: %s", ErrInvalidJSON, err)
+	}
+	if tx.ReceiverPubKey, err = res.To.PubKey(); err != nil {
+		return fmt.Errorf("%w: to: %s", ErrInvalidJSON, err)
+	}
+
+	sig, err := hex.DecodeString(strings.TrimPrefix(res.Signature, "0x"))
+	if err != nil || len(sig) != len(tx.Signature.Bytes()) {
+		return fmt.Errorf("%w: signature", ErrInvalidJSON)
+	}
+	if _, err := tx.Signature.SetBytes(sig); err != nil {
+		return fmt.Errorf("%w: signature: %s", ErrInvalidJSON, err)
+	}
+
+	*t = tx
+	return nil
+}
+
+// decimal amount, lower than the modulus
+func ParseAmount(s string) (fr.Element, error) {
+	var b big.Int
+	var res fr.Element
+	if _, ok := b.SetString(s, 10); !ok || b.Sign() < 0 || b.Cmp(fr.Modulus()) >= 0 {
+		return res, fmt.Errorf("invalid amount %q", s)
+	}
+	res.SetBigInt(&b)
+	return res, nil
+}
@@ -10,15 +10,18 @@ import (
 
 type Transfer struct {
 	Nonce          uint64
+	TokenID        uint64 // asset of the amount and the fee
 	Amount         fr.Element
+	Fee            fr.Element // credited to the operator account
 	SenderPubKey   eddsa.PublicKey
 	ReceiverPubKey eddsa.PublicKey
 	Signature      eddsa.Signature
 }
 
-func NewTransfer(amount uint64, from, to eddsa.PublicKey, nonce uint64) Transfer {
+func NewTransfer(amount, fee uint64, from, to eddsa.PublicKey, nonce uint64) Transfer {
 	var t Transfer
 	t.Amount.SetUint64(amount)
+	t.Fee.SetUint64(fee)
 	t.SenderPubKey = from
 	t.ReceiverPubKey = to
 	t.Nonce = nonce
@@ -26,11 +29,16 @@ func NewTransfer(amount uint64, from, to eddsa.PublicKey, nonce uint64) Transfer
 	return t
 }
 
-func (t *Transfer) SetSign(hFunc hash.Hash, privateKey eddsa.PrivateKey) {
-	t.Signature = t.Sign(hFunc, privateKey)
+func (t *Transfer) SetSign(hFunc hash.Hash, privateKey eddsa.PrivateKey) error {
+	signature, err := t.Sign(hFunc, privateKey)
+	if err != nil {
+		return err
+	}
+	t.Signature = signature
+	return nil
 }
 
-func (t *Transfer) Sign(hFunc hash.Hash, privateKey eddsa.PrivateKey) eddsa.Signature {
+func (t *Transfer) Sign(hFunc hash.Hash, privateKey eddsa.PrivateKey) (eddsa.Signature, error) {
 
 	msg := t.Message(hFunc)
 	return signature.Sign(msg, privateKey, hFunc)
@@ -46,7 +54,15 @@ func (t *Transfer) Message(hFunc hash.Hash) []byte {
 	nonceBytes := frNonce.Bytes()
 	hFunc.Write(nonceBytes[:])
 
-	buf1 := t.Amount.Bytes()
+	var frTokenID fr.Element
+	frTokenID.SetUint64(t.TokenID)
+	buf1 := frTokenID.Bytes()
+	hFunc.Write(buf1[:])
+
+	buf1 = t.Amount.Bytes()
+	hFunc.Write(buf1[:])
+
+	buf1 = t.Fee.Bytes()
 	hFunc.Write(buf1[:])
 
 	buf1 = t.SenderPubKey.A.X.Bytes()
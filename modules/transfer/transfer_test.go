@@ -2,6 +2,8 @@ package transfer
 
 import (
 	"ZK-Rollup/signature"
+	"encoding/json"
+	"strings"
 	"testing"
 
 	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
@@ -24,13 +26,43 @@ func TestTransferSignature(t *testing.T) {
 
 	hFunc := mimc.NewMiMC()
 
-	transferTx.SetSign(hFunc, privKey2)
+	assert.NoError(t, transferTx.SetSign(hFunc, privKey2))
 	verified, err := transferTx.VerifySignature(hFunc)
 	assert.Equal(t, verified, false)
 	assert.NoError(t, err)
 
-	transferTx.SetSign(hFunc, privKey1)
+	assert.NoError(t, transferTx.SetSign(hFunc, privKey1))
 	verified, err = transferTx.VerifySignature(hFunc)
 	assert.Equal(t, verified, true)
 	assert.NoError(t, err)
 }
+
+func TestTransferJSON(t *testing.T) {
+	privKey1, pubKey1 := signature.GenerateKeys(1)
+	_, pubKey2 := signature.GenerateKeys(2)
+
+	hFunc := mimc.NewMiMC()
+	tx := NewTransfer(12, 1, pubKey1, pubKey2, 3)
+	tx.TokenID = 2
+	assert.NoError(t, tx.SetSign(hFunc, privKey1))
+
+	data, err := json.Marshal(tx)
+	assert.NoError(t, err)
+
+	var decoded Transfer
+	assert.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, tx, decoded)
+	verified, err := decoded.VerifySignature(hFunc)
+	assert.NoError(t, err)
+	assert.True(t, verified)
+
+	invalid := []string{
+		`{"amount": "-1", "fee": "0"}`,
+		`{"amount": "21888242871839275222246405745257275088548364400416034343698204186575808495617", "fee": "0"}`,
+		strings.Replace(string(data), `"from":"0x`, `"from":"0xff`, 1),
+		strings.Replace(string(data), `"signature":"0x`, `"signature":"0x12`, 1),
+	}
+	for _, s := range invalid {
+		assert.ErrorIs(t, json.Unmarshal([]byte(s), &decoded), ErrInvalidJSON, s)
+	}
+}
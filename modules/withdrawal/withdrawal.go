@@ -0,0 +1,95 @@
+package withdrawal
+
+import (
+	"ZK-Rollup/signature"
+	"hash"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark-crypto/ecc/bn254/twistededwards/eddsa"
+)
+
+// debits the account in the rollup, the amount is paid out to the recipient on L1
+type Withdrawal struct {
+	Nonce     uint64
+	TokenID   uint64 // asset withdrawn
+	Amount    fr.Element
+	PubKey    eddsa.PublicKey // account debited
+	Recipient fr.Element      // address of the recipient on L1
+	Signature eddsa.Signature
+}
+
+// withdrawal emitted by a batch proof, the L1 side pays out against it
+type Record struct {
+	BatchNumber uint64
+	Recipient   fr.Element
+	TokenID     uint64
+	Amount      fr.Element
+}
+
+func NewWithdrawal(amount uint64, from eddsa.PublicKey, recipient fr.Element, nonce uint64) Withdrawal {
+	var w Withdrawal
+	w.Amount.SetUint64(amount)
+	w.PubKey = from
+	w.Recipient = recipient
+	w.Nonce = nonce
+
+	return w
+}
+
+func (w *Withdrawal) SetSign(hFunc hash.Hash, privateKey eddsa.PrivateKey) error {
+	signature, err := w.Sign(hFunc, privateKey)
+	if err != nil {
+		return err
+	}
+	w.Signature = signature
+	return nil
+}
+
+func (w *Withdrawal) Sign(hFunc hash.Hash, privateKey eddsa.PrivateKey) (eddsa.Signature, error) {
+	msg := w.Message(hFunc)
+	return signature.Sign(msg, privateKey, hFunc)
+}
+
+// hash of nonce ∥ tokenID ∥ amount ∥ pubkeyX ∥ pubkeyY ∥ recipient
+func (w *Withdrawal) Message(hFunc hash.Hash) []byte {
+	hFunc.Reset()
+
+	var frNonce fr.Element
+	frNonce.SetUint64(w.Nonce)
+	buf := frNonce.Bytes()
+	hFunc.Write(buf[:])
+
+	var frTokenID fr.Element
+	frTokenID.SetUint64(w.TokenID)
+	buf = frTokenID.Bytes()
+	hFunc.Write(buf[:])
+
+	buf = w.Amount.Bytes()
+	hFunc.Write(buf[:])
+
+	buf = w.PubKey.A.X.Bytes()
+	hFunc.Write(buf[:])
+
+	buf = w.PubKey.A.Y.Bytes()
+	hFunc.Write(buf[:])
+
+	buf = w.Recipient.Bytes()
+	hFunc.Write(buf[:])
+
+	return hFunc.Sum(nil)
+}
+
+func (w *Withdrawal) VerifySignature(hFunc hash.Hash) (bool, error) {
+	msg := w.Message(hFunc)
+	return signature.Verify(msg, w.PubKey, w.Signature.Bytes(), hFunc)
+}
+
+// record of the withdrawal in the batch
+func (w *Withdrawal) Record(batchNumber uint64) Record {
+	return Record{
+		BatchNumber: batchNumber,
+		Recipient:   w.Recipient,
+		TokenID:     w.TokenID,
+		Amount:      w.Amount,
+	}
+}
@@ -0,0 +1,35 @@
+package withdrawal
+
+import (
+	"ZK-Rollup/signature"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr/mimc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithdrawalSignature(t *testing.T) {
+	privKey1, pubKey1 := signature.GenerateKeys(1)
+	privKey2, _ := signature.GenerateKeys(2)
+
+	w := NewWithdrawal(10, pubKey1, fr.NewElement(0xbeef), 1)
+
+	hFunc := mimc.NewMiMC()
+
+	assert.NoError(t, w.SetSign(hFunc, privKey2))
+	verified, err := w.VerifySignature(hFunc)
+	assert.Equal(t, verified, false)
+	assert.NoError(t, err)
+
+	assert.NoError(t, w.SetSign(hFunc, privKey1))
+	verified, err = w.VerifySignature(hFunc)
+	assert.Equal(t, verified, true)
+	assert.NoError(t, err)
+
+	// recipient is signed
+	w.Recipient = fr.NewElement(0xdead)
+	verified, err = w.VerifySignature(hFunc)
+	assert.Equal(t, verified, false)
+	assert.NoError(t, err)
+}
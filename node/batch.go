@@ -0,0 +1,188 @@
+package node
+
+import (
+	"ZK-Rollup/account"
+	"ZK-Rollup/circuit"
+	"ZK-Rollup/modules/deposit"
+	"ZK-Rollup/modules/transfer"
+	"ZK-Rollup/modules/withdrawal"
+	"errors"
+	"fmt"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"log/slog"
+)
+
+// fills the empty slots of the current batch with no-ops, emits the
+// witness job of the batch and starts a new batch
+func (o *Node) SealBatch() error {
+	if o.batch == 0 {
+		return nil
+	}
+
+	// padding is undone if the batch can't be sealed
+	stateTx := o.Begin()
+	for i := o.batch; i < o.cfg.BatchSize; i++ {
+		if err := o.SetNoop(i); err != nil {
+			stateTx.Rollback()
+			return err
+		}
+	}
+	if err := o.CreditFees(); err != nil {
+		stateTx.Rollback()
+		return err
+	}
+
+	rootBefore, _ := o.witnesses.RootHashBefore.([]byte)
+	job := WitnessJob{
+		BatchNumber: o.BatchCount + 1,
+		Witness:     o.witnesses,
+		RootBefore:  rootBefore,
+		RootAfter:   o.StateRoot(),
+		Deposits:    o.deposits,
+		Withdrawals: o.withdrawals,
+		StartTime:   o.batchStartTime,
+	}
+
+	// the batch is sealed once it's committed to the store
+	if err := o.commitBatch(job); err != nil {
+		stateTx.Rollback()
+		return err
+	}
+	stateTx.Commit()
+
+	o.BatchCount++
+
+	// hand over the witness to the prover
+	o.jobs <- job
+	slog.Info(fmt.Sprintf("batch-%d sealed", o.BatchCount))
+
+	o.newBatch()
+
+	return nil
+}
+
+// start the next batch with an empty witness
+func (o *Node) newBatch() {
+	o.batch = 0
+	o.witnesses = circuit.NewCircuit(o.cfg)
+	o.witnesses.BatchNumber = o.BatchCount + 1
+	o.deposits = make([]deposit.Deposit, o.cfg.BatchSize)
+	o.withdrawals = make([]withdrawal.Record, o.cfg.BatchSize)
+	o.fees = [account.NbTokens]fr.Element{}
+	o.updated = make(map[uint64]struct{})
+}
+
+// fees of the current batch with the fee of the token added,
+// if they can still be credited to the operator account
+func (o *Node) addFee(tokenID uint64, fee fr.Element) ([account.NbTokens]fr.Element, error) {
+	fees := o.fees
+	operator, err := o.ReadAccount(uint64(o.cfg.Operator))
+	if err != nil {
+		return fees, fmt.Errorf("operator: %w", err)
+	}
+
+	var balance fr.Element
+	fees[tokenID].Add(&fees[tokenID], &fee)
+	balance.Add(&operator.Balances[tokenID], &fees[tokenID])
+	if !IsBalance(&balance) {
+		return fees, fmt.Errorf("operator: %w", ErrBalanceOverflow)
+	}
+	return fees, nil
+}
+
+// credit the fees of the batch to the operator account, after the last tx of the batch
+func (o *Node) CreditFees() error {
+	operator, err := o.ReadAccount(uint64(o.cfg.Operator))
+	if err != nil {
+		return fmt.Errorf("operator: %w", err)
+	}
+
+	operatorAfter := operator
+	for k := range o.fees {
+		operatorAfter.Balances[k].Add(&operator.Balances[k], &o.fees[k])
+		if !IsBalance(&operatorAfter.Balances[k]) {
+			return fmt.Errorf("operator: %w", ErrBalanceOverflow)
+		}
+	}
+
+	o.witnesses.SetOperatorAccounts(operator, operatorAfter)
+
+	proof, _, err := o.GetMerkleProof(operator.Index)
+	if err != nil {
+		return err
+	}
+	o.witnesses.MerkleProofOperatorBefore = proof
+
+	o.UpdateAccount(operatorAfter)
+
+	proof, root, err := o.GetMerkleProof(operator.Index)
+	if err != nil {
+		return err
+	}
+	o.witnesses.MerkleProofOperatorAfter = proof
+	o.witnesses.RootHashAfter = root
+
+	return nil
+}
+
+// fill the slot with a no-op, which doesn't change the state.
+// no-ops use the first account as both sender and receiver with a zero amount
+func (o *Node) SetNoop(numTransfer int) error {
+	acc, err := o.ReadAccount(0)
+	if err != nil {
+		return err
+	}
+
+	o.witnesses.SetBeforeAccounts(uint64(numTransfer), acc, acc)
+	o.witnesses.SetAfterAccounts(uint64(numTransfer), acc, acc)
+
+	err = o.SetMerkleProofs(acc, acc, acc, acc, uint64(numTransfer))
+	if err != nil {
+		return err
+	}
+
+	// signature of no-ops is not checked,
+	// R is set to the identity point to keep it on the curve
+	var t transfer.Transfer
+	t.Nonce = acc.Nonce
+	t.SenderPubKey = acc.PubKey
+	t.ReceiverPubKey = acc.PubKey
+	t.Signature.R.X.SetZero()
+	t.Signature.R.Y.SetOne()
+
+	o.SetTxns(uint64(numTransfer), t)
+	o.witnesses.TxTypes[numTransfer] = circuit.TxTypeNoop
+	o.setDeposit(uint64(numTransfer), deposit.Deposit{})
+	o.setWithdrawal(uint64(numTransfer), withdrawal.Record{})
+
+	return nil
+}
+
+// executes the txs in a new batch and seals it, returns the witness job of the batch
+// and the error of every tx (nil if executed). Rejected txs are skipped as in ListenForTransfers,
+// the batch isn't sealed if every tx is rejected. The node shouldn't be listening for txs
+func (o *Node) ExecuteBatch(txs []any) (WitnessJob, []error, error) {
+	if o.batch != 0 {
+		return WitnessJob{}, nil, ErrBatchOpen
+	}
+	if len(txs) == 0 || len(txs) > o.cfg.BatchSize {
+		return WitnessJob{}, nil, fmt.Errorf("%d txs, a batch has 1 to %d txs", len(txs), o.cfg.BatchSize)
+	}
+
+	errs := make([]error, len(txs))
+	for i, tx := range txs {
+		if errs[i] = o.apply(tx, o.batch); errs[i] == nil {
+			o.TxCount++
+			o.batch++
+		}
+	}
+	if o.batch == 0 {
+		return WitnessJob{}, errs, errors.New("every tx is rejected")
+	}
+
+	if err := o.SealBatch(); err != nil {
+		return WitnessJob{}, errs, err
+	}
+	return <-o.jobs, errs, nil
+}
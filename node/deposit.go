@@ -0,0 +1,88 @@
+package node
+
+import (
+	"ZK-Rollup/account"
+	"ZK-Rollup/circuit"
+	"ZK-Rollup/modules/deposit"
+	"ZK-Rollup/modules/transfer"
+	"ZK-Rollup/modules/withdrawal"
+	"fmt"
+	"log/slog"
+)
+
+// registers the deposit as a new account in the next empty leaf + build witness of zk circuit
+// the state and the witness are left unchanged if the deposit is rejected
+func (o *Node) ApplyDeposit(d deposit.Deposit, numTransfer int) error {
+	stateTx := o.Begin()
+	if err := o.applyDeposit(d, numTransfer); err != nil {
+		stateTx.Rollback()
+		return err
+	}
+	stateTx.Commit()
+	return nil
+}
+
+// deposits use the first account as the sender, which is left unchanged as in no-ops,
+// and the empty leaf as the receiver
+func (o *Node) applyDeposit(d deposit.Deposit, numTransfer int) error {
+	// same checks as account.Address.PubKey, the identity is refused
+	if !d.PubKey.A.IsOnCurve() || d.PubKey.A.IsZero() {
+		return ErrInvalidPubKey
+	}
+	if _, ok := o.AccountMap[account.AddressOf(d.PubKey)]; ok {
+		return ErrAccountExists
+	}
+	if o.nbAccounts >= o.cfg.NbAccounts {
+		return ErrStateFull
+	}
+	if d.TokenID >= account.NbTokens {
+		return ErrUnknownToken
+	}
+	if !IsBalance(&d.Amount) {
+		return ErrAmountOutOfRange
+	}
+
+	acc, err := o.ReadAccount(0)
+	if err != nil {
+		return err
+	}
+
+	empty := account.Account{Index: uint64(o.nbAccounts)}
+	newAccount := account.Account{
+		Index:  empty.Index,
+		PubKey: d.PubKey,
+	}
+	newAccount.Balances[d.TokenID] = d.Amount
+
+	o.witnesses.SetBeforeAccounts(uint64(numTransfer), acc, empty)
+	o.witnesses.SetAfterAccounts(uint64(numTransfer), acc, newAccount)
+
+	err = o.SetMerkleProofs(acc, acc, empty, newAccount, uint64(numTransfer))
+	if err != nil {
+		return err
+	}
+
+	// deposits are not signed, same transfer as no-ops
+	var t transfer.Transfer
+	t.Nonce = acc.Nonce
+	t.TokenID = d.TokenID
+	t.SenderPubKey = acc.PubKey
+	t.ReceiverPubKey = empty.PubKey
+	t.Signature.R.X.SetZero()
+	t.Signature.R.Y.SetOne()
+
+	o.SetTxns(uint64(numTransfer), t)
+	o.witnesses.TxTypes[numTransfer] = circuit.TxTypeDeposit
+	o.setDeposit(uint64(numTransfer), d)
+	o.setWithdrawal(uint64(numTransfer), withdrawal.Record{})
+
+	slog.Info(fmt.Sprintf("account-%d registered with token-%d balance %s", newAccount.Index, d.TokenID, d.Amount.String()))
+
+	return nil
+}
+
+// set the deposit of the slot, in the witness and in the public inputs of the batch
+func (o *Node) setDeposit(numTransfer uint64, d deposit.Deposit) {
+	o.deposits[numTransfer] = d
+	o.witnesses.SetDeposit(numTransfer, d)
+}
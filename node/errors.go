@@ -0,0 +1,20 @@
+package node
+
+import "errors"
+
+// errors of rejected txs, reported back to the submitter
+var (
+	ErrUnknownAccount      = errors.New("account doesn't exist")
+	ErrInsufficientBalance = errors.New("not enough balance")
+	ErrBadSignature        = errors.New("signature verification failed")
+	ErrBadNonce            = errors.New("invalid nonce")
+	ErrAmountOutOfRange    = errors.New("amount out of range")
+	ErrBalanceOutOfRange   = errors.New("balance out of range")
+	ErrBalanceOverflow     = errors.New("receiver balance overflow")
+	ErrSelfTransfer        = errors.New("sender and receiver are the same account")
+	ErrAccountExists       = errors.New("account already exists")
+	ErrInvalidPubKey       = errors.New("public key is not a point of the curve")
+	ErrUnknownToken        = errors.New("unknown token ID")
+	ErrStateFull           = errors.New("no empty leaf left in the state")
+	ErrBatchFull           = errors.New("batch is full, it can't be sealed yet")
+)
@@ -0,0 +1,108 @@
+package node
+
+import (
+	"ZK-Rollup/circuit"
+	"ZK-Rollup/config"
+	"ZK-Rollup/modules/deposit"
+	"ZK-Rollup/modules/withdrawal"
+	"ZK-Rollup/store"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/witness"
+	"github.com/consensys/gnark/frontend"
+)
+
+// witness job saved into the store until the batch is proven, the witness is the binary full witness
+type jobJSON struct {
+	BatchNumber uint64              `json:"batchNumber"`
+	RootBefore  []byte              `json:"rootBefore"`
+	RootAfter   []byte              `json:"rootAfter"`
+	Deposits    []deposit.Deposit   `json:"deposits"`
+	Withdrawals []withdrawal.Record `json:"withdrawals"`
+	StartTime   time.Time           `json:"startTime"`
+	Witness     []byte              `json:"witness"`
+}
+
+func encodeJob(job WitnessJob) ([]byte, error) {
+	w, err := frontend.NewWitness(&job.Witness, ecc.BN254.ScalarField())
+	if err != nil {
+		return nil, err
+	}
+	witnessBytes, err := w.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(&jobJSON{
+		BatchNumber: job.BatchNumber,
+		RootBefore:  job.RootBefore,
+		RootAfter:   job.RootAfter,
+		Deposits:    job.Deposits,
+		Withdrawals: job.Withdrawals,
+		StartTime:   job.StartTime,
+		Witness:     witnessBytes,
+	})
+}
+
+// job of the circuit shaped by cfg
+func decodeJob(cfg config.Config, data []byte) (WitnessJob, error) {
+	var res jobJSON
+	if err := json.Unmarshal(data, &res); err != nil {
+		return WitnessJob{}, err
+	}
+	w, err := witness.New(ecc.BN254.ScalarField())
+	if err != nil {
+		return WitnessJob{}, err
+	}
+	if err := w.UnmarshalBinary(res.Witness); err != nil {
+		return WitnessJob{}, err
+	}
+	assignment := circuit.NewCircuit(cfg)
+	if err := assignment.Assign(w); err != nil {
+		return WitnessJob{}, err
+	}
+
+	return WitnessJob{
+		BatchNumber: res.BatchNumber,
+		Witness:     assignment,
+		RootBefore:  res.RootBefore,
+		RootAfter:   res.RootAfter,
+		Deposits:    res.Deposits,
+		Withdrawals: res.Withdrawals,
+		StartTime:   res.StartTime,
+	}, nil
+}
+
+// witness jobs of the batches committed to the store but not proven (crash before their proof was saved),
+// in order. They are the last batches of the store
+func PendingJobs(cfg config.Config, st *store.Store) ([]WitnessJob, error) {
+	numbers, err := st.PendingJobs()
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := make([]WitnessJob, 0, len(numbers))
+	for i, number := range numbers {
+		if number != numbers[0]+uint64(i) {
+			return nil, fmt.Errorf("%w: no job for batch-%d", store.ErrCorrupted, numbers[0]+uint64(i))
+		}
+		data, err := st.Job(number)
+		if err != nil {
+			return nil, err
+		}
+		job, err := decodeJob(cfg, data)
+		if err != nil {
+			return nil, fmt.Errorf("%w: job of batch-%d: %s", store.ErrCorrupted, number, err)
+		}
+		if job.BatchNumber != number {
+			return nil, fmt.Errorf("%w: job of batch-%d", store.ErrCorrupted, number)
+		}
+		jobs = append(jobs, job)
+	}
+	if len(jobs) != 0 && jobs[len(jobs)-1].BatchNumber != st.LastBatch() {
+		return nil, fmt.Errorf("%w: no job for batch-%d", store.ErrCorrupted, st.LastBatch())
+	}
+	return jobs, nil
+}
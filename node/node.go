@@ -3,17 +3,21 @@ package node
 import (
 	"ZK-Rollup/account"
 	"ZK-Rollup/circuit"
+	"ZK-Rollup/config"
+	"ZK-Rollup/modules/deposit"
 	"ZK-Rollup/modules/transfer"
-	"ZK-Rollup/proofSystem"
+	"ZK-Rollup/modules/withdrawal"
 	"time"
 
 	"ZK-Rollup/signature"
+	"ZK-Rollup/stateTree"
+	"ZK-Rollup/store"
 	"bytes"
 	"errors"
 	"fmt"
 	"hash"
-	"log"
 	"log/slog"
+	"math/big"
 
 	"github.com/consensys/gnark-crypto/accumulator/merkletree"
 	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
@@ -22,166 +26,350 @@ import (
 	"github.com/consensys/gnark/std/accumulator/merkle"
 )
 
-var hFunc = mimc.NewMiMC()
-
 var MaxTxBuffer = 10
 
+// number of batches proven concurrently
+var NbProverWorkers = 2
+
+// attempts to prove a batch, and the delay between them, before the prover pool stops
+var ProveAttempts = 3
+var ProveRetryDelay = 5 * time.Second
+
+// max time to wait for a batch to be filled, before it is sealed with no-ops
+var BatchTimeout = 10 * time.Second
+
+// tx submitted to the node (transfer.Transfer, deposit.Deposit or withdrawal.Withdrawal)
+type txRequest struct {
+	tx     any
+	result chan txResult
+}
+
+// number of the batch the tx is executed in, or the error if the tx is rejected
+type txResult struct {
+	batchNumber uint64
+	err         error
+}
+
 type Queue struct {
-	txChannel chan transfer.Transfer
+	txChannel chan txRequest
+	views     chan func() // reads of the state, run between two txs
 }
 
 func NewQueue(circuitBatchSize int) Queue {
-	resChan := make(chan transfer.Transfer, circuitBatchSize)
+	resChan := make(chan txRequest, circuitBatchSize)
 	return Queue{
 		txChannel: resChan,
+		views:     make(chan func()),
 	}
 }
 
 type Node struct {
-	TxCount    uint64
-	State      []byte            // list of account bytes appended
-	StateHash  []byte            // hash of account bytes appended
-	AccountMap map[string]uint64 // pubkey to index map
-	nbAccounts int               // number of accounts
-	hFunc      hash.Hash         // hash function used
-	queue      Queue             // channel which recieves transfer request
-	batch      int               // tx count?
-	witnesses  circuit.Circuit   // circuit
+	cfg         config.Config // shape of the state & the circuit
+	TxCount     uint64
+	BatchCount  uint64                       // number of batches sealed
+	State       []byte                       // list of account bytes appended
+	StateHash   []byte                       // hash of account bytes appended
+	tree        *stateTree.Tree              // merkle tree of the account hashes
+	AccountMap  map[account.Address]uint64   // address to index map
+	nbAccounts  int                          // number of accounts
+	hFunc       hash.Hash                    // hash function used
+	queue       Queue                        // channel which recieves transfer request
+	batch       int                          // number of txs in the current batch
+	witnesses   circuit.Circuit              // circuit
+	deposits    []deposit.Deposit            // deposits of the current batch, public inputs of its proof
+	withdrawals []withdrawal.Record          // withdrawals of the current batch, public outputs of its proof
+	fees        [account.NbTokens]fr.Element // fees of the current batch per token, credited to the operator account
+	jobs        chan WitnessJob              // witness jobs of sealed batches, consumed by the prover
+
+	batchStartTime time.Time // time of the first tx in the current batch
+	stateTx        *StateTx  // open state transaction
+
+	store   *store.Store        // durable state, nil for an in-memory node
+	updated map[uint64]struct{} // accounts updated in the current batch, written to the store when it's sealed
 }
 
-func NewNode(nbAccounts int, data []byte) Node {
-	if len(data) != nbAccounts*account.AccountSizeInBytes {
-		panic("invalid accounts data")
+// node with the given accounts, state tree & circuit are sized by cfg
+func NewNode(cfg config.Config, data []byte) Node {
+	node, err := newNode(cfg, data, nil)
+	if err != nil {
+		panic(err)
+	}
+	return node
+}
+
+// node with the given accounts. The tree is built from the accounts if nil,
+// a given tree (recovered from the store) should hold the hashes of the accounts
+func newNode(cfg config.Config, data []byte, tree *stateTree.Tree) (Node, error) {
+	if err := cfg.Validate(); err != nil {
+		return Node{}, err
 	}
+	if len(data)%account.AccountSizeInBytes != 0 || len(data) > cfg.NbAccounts*account.AccountSizeInBytes {
+		return Node{}, errors.New("invalid accounts data")
+	}
+	nbAccounts := len(data) / account.AccountSizeInBytes
 	state := data
+	// every node has its own hash function, nodes may run concurrently
+	hFunc := mimc.NewMiMC()
 	hashState := make([]byte, nbAccounts*hFunc.Size())
-	accountsMap := make(map[string]uint64)
+	accountsMap := make(map[account.Address]uint64)
+
+	// leaves & the proof path above them
+	recovered := tree != nil
+	if !recovered {
+		tree = stateTree.New(mimc.NewMiMC(), cfg.TreeDepth())
+	}
 
 	for i := 0; i < nbAccounts; i++ {
-		hFunc.Reset()
 		accountBytes := state[account.AccountSizeInBytes*i : account.AccountSizeInBytes*(i+1)]
+
+		// only canonical account bytes are hashed into the state
+		var acc account.Account
+		if err := account.UnMarshal(&acc, accountBytes); err != nil {
+			return Node{}, fmt.Errorf("invalid account-%d: %w", i, err)
+		}
+		if acc.Index != uint64(i) {
+			return Node{}, fmt.Errorf("invalid account-%d: index %d", i, acc.Index)
+		}
+		// a pubkey is registered once
+		if _, ok := accountsMap[acc.Address()]; ok {
+			return Node{}, fmt.Errorf("invalid account-%d: %w", i, ErrAccountExists)
+		}
+		accountsMap[acc.Address()] = uint64(i)
+
+		hFunc.Reset()
 		hFunc.Write(accountBytes)
 		accountHash := hFunc.Sum(nil)
 		copy(hashState[hFunc.Size()*i:hFunc.Size()*(i+1)], accountHash)
-		var acc account.Account
-		account.UnMarshal(&acc, accountBytes)
-		keyBytes := acc.PubKey.A.X.Bytes()
-		accountsMap[string(keyBytes[:])] = uint64(i)
-
+		if recovered {
+			if !bytes.Equal(tree.Leaf(uint64(i)), accountHash) {
+				return Node{}, fmt.Errorf("invalid account-%d: leaf mismatch", i)
+			}
+			continue
+		}
+		if err := tree.Set(uint64(i), accountHash); err != nil {
+			return Node{}, err
+		}
 	}
 
 	queue := NewQueue(MaxTxBuffer)
-	circuit := circuit.NewCircuit()
 
-	return Node{
+	node := Node{
+		cfg:        cfg,
 		TxCount:    0,
 		State:      state,
 		StateHash:  hashState,
+		tree:       tree,
 		nbAccounts: nbAccounts,
 		hFunc:      hFunc,
 		queue:      queue,
 		batch:      0,
 		AccountMap: accountsMap,
-		witnesses:  circuit,
+		jobs:       make(chan WitnessJob, MaxTxBuffer),
 	}
+	node.newBatch()
+
+	return node, nil
+}
+
+// witness jobs of the sealed batches
+func (o *Node) Jobs() <-chan WitnessJob {
+	return o.jobs
 }
 
 func (o *Node) ListenForTransfers() {
-	for transfer := range o.queue.txChannel {
-		startTime := time.Now()
-		slog.Info("recieved transaction!")
-
-		// TODO: check tx before updating state
-		// update state
-		err := o.UpdateState(transfer, 0)
-		if err != nil {
-			// TODO: handle gracefully
-			log.Fatal(err)
+	// fires when the current batch is open for too long
+	var batchTimeout <-chan time.Time
+	timeout := BatchTimeout
+
+	for {
+		select {
+		case req, ok := <-o.queue.txChannel:
+			if !ok {
+				return
+			}
+			slog.Info("recieved transaction!")
+
+			// update state
+			err := o.apply(req.tx, o.batch)
+			req.result <- txResult{batchNumber: o.BatchCount + 1, err: err}
+			if err != nil {
+				slog.Error(fmt.Sprintf("tx rejected: %s", err))
+				continue
+			}
+
+			o.TxCount++
+			o.batch++
+
+			if o.batch == 1 {
+				o.batchStartTime = time.Now()
+				batchTimeout = time.After(timeout)
+			}
+
+			// wait for the batch to be filled
+			if o.batch < o.cfg.BatchSize {
+				continue
+			}
+
+		case view := <-o.queue.views:
+			view()
+			continue
+
+		case <-batchTimeout:
+			slog.Info(fmt.Sprintf("batch timeout, sealing batch with %d txs", o.batch))
 		}
 
-		o.TxCount++
+		batchTimeout = nil
+		if err := o.SealBatch(); err != nil {
+			// the batch stays open, txs are rejected with ErrBatchFull once it's full.
+			// sealing is retried after the timeout
+			slog.Error(fmt.Sprintf("unable to seal batch, retrying in %s: %s", timeout, err))
+			batchTimeout = time.After(timeout)
+		}
+	}
+}
+
+// submits the transfer to the node and waits until it is executed,
+// returns the error if the transfer is rejected
+func (o *Node) SubmitTransfer(t transfer.Transfer) error {
+	_, err := o.Submit(t)
+	return err
+}
+
+// submits the deposit to the node and waits until it is executed,
+// returns the error if the deposit is rejected
+func (o *Node) SubmitDeposit(d deposit.Deposit) error {
+	_, err := o.Submit(d)
+	return err
+}
 
-		// TODO: indendent Prover node and Verifier Node
-		// generate Zk-proof and Verify the proof
-		proofSystem.Verify(o.witnesses, o.TxCount)
-		timeInSeconds := time.Since(startTime).Seconds()
-		slog.Info(fmt.Sprintln("Time taken for complete transaction life cycle:", timeInSeconds, "seconds!"))
-		fmt.Println()
-		fmt.Println()
+// submits the withdrawal to the node and waits until it is executed,
+// returns the error if the withdrawal is rejected
+func (o *Node) SubmitWithdrawal(w withdrawal.Withdrawal) error {
+	_, err := o.Submit(w)
+	return err
+}
+
+// submits the tx to the node and waits until it is executed,
+// returns the number of the batch it's executed in, or the error if the tx is rejected
+func (o *Node) Submit(tx any) (uint64, error) {
+	result := make(chan txResult, 1)
+	o.queue.txChannel <- txRequest{tx: tx, result: result}
+	res := <-result
+	return res.batchNumber, res.err
+}
+
+// runs fn in the loop of ListenForTransfers, between two txs, so that fn reads
+// the state of the running node without racing with it. Blocks until the node listens
+func (o *Node) View(fn func()) {
+	done := make(chan struct{})
+	o.queue.views <- func() {
+		fn()
+		close(done)
+	}
+	<-done
+}
+
+// executes the tx in the slot numTransfer of the current batch
+func (o *Node) apply(tx any, numTransfer int) error {
+	// a full batch stays open while it can't be sealed
+	if numTransfer >= o.cfg.BatchSize {
+		return ErrBatchFull
+	}
+	switch tx := tx.(type) {
+	case transfer.Transfer:
+		return o.UpdateState(tx, numTransfer)
+	case deposit.Deposit:
+		return o.ApplyDeposit(tx, numTransfer)
+	case withdrawal.Withdrawal:
+		return o.ApplyWithdrawal(tx, numTransfer)
+	default:
+		return fmt.Errorf("unknown tx type %T", tx)
 	}
 }
 
 // Read Account from state (byte data)
-func (o *Node) ReadAccount(i uint64) account.Account {
+func (o *Node) ReadAccount(i uint64) (account.Account, error) {
+	if i >= uint64(o.nbAccounts) {
+		return account.Account{}, ErrUnknownAccount
+	}
 	accountBytes := o.State[account.AccountSizeInBytes*int(i) : (int(i)+1)*account.AccountSizeInBytes]
 	var acc account.Account
 	if err := account.UnMarshal(&acc, accountBytes); err != nil {
-		log.Fatal(err)
+		return account.Account{}, err
 	}
-	return acc
+	return acc, nil
 }
 
 // update state + build witness of zk circuit
+// the state and the witness are left unchanged if the transfer is rejected
 func (o *Node) UpdateState(t transfer.Transfer, numTransfer int) error {
+	stateTx := o.Begin()
+	if err := o.updateState(t, numTransfer); err != nil {
+		stateTx.Rollback()
+		return err
+	}
+	stateTx.Commit()
+	return nil
+}
 
-	slog.Info("updating state...")
-	senderpubkeyBytes := t.SenderPubKey.A.X.Bytes()
-	senderKey := string(senderpubkeyBytes[:])
+func (o *Node) updateState(t transfer.Transfer, numTransfer int) error {
 
-	sender, err := o.VerifyAndGetAccount(senderKey)
+	slog.Info("updating state...")
+	sender, err := o.VerifyAndGetAccount(account.AddressOf(t.SenderPubKey))
 	if err != nil {
 		slog.Error("sender not verified")
-		return err
+		return fmt.Errorf("sender: %w", err)
 	}
 
-	receiverpubkeyBytes := t.ReceiverPubKey.A.X.Bytes()
-	receiverKey := string(receiverpubkeyBytes[:])
-
-	receiver, err := o.VerifyAndGetAccount(receiverKey)
+	receiver, err := o.VerifyAndGetAccount(account.AddressOf(t.ReceiverPubKey))
 	if err != nil {
 		slog.Error("receiver not verified")
-		return err
+		return fmt.Errorf("receiver: %w", err)
 	}
 
-	// set before accounts  & pubkeys & leaf accounts
-	o.witnesses.SetBeforeAccounts(uint64(numTransfer), sender, receiver)
+	if sender.Index == receiver.Index {
+		return ErrSelfTransfer
+	}
 
-	// set before accounts before merkle proofs & before merkle root
-	err = o.SetMerkleProofs(true, sender, receiver, uint64(numTransfer))
+	senderAfter, receiverAfter, err := VerifyAndGetUpdatedAccounts(sender, receiver, t, o.hFunc)
 	if err != nil {
-		slog.Error("unable to set merkle proofs")
+		slog.Error("unable to get updated accounts")
 		return err
 	}
 
-	senderAfter, receiverAfter, err := VerifyAndGetUpdatedAccounts(sender, receiver, t, hFunc)
+	fees, err := o.addFee(t.TokenID, t.Fee)
 	if err != nil {
-		slog.Error("unable to get updated accounts")
 		return err
 	}
 
-	// update state
-	o.UpdateAccounts(senderAfter, receiverAfter)
+	// set before accounts  & pubkeys & leaf accounts
+	o.witnesses.SetBeforeAccounts(uint64(numTransfer), sender, receiver)
 
 	// set after accounts
 	o.witnesses.SetAfterAccounts(uint64(numTransfer), senderAfter, receiverAfter)
 
-	// set after merkle proofs & after merkle roots
-	err = o.SetMerkleProofs(false, senderAfter, receiverAfter, uint64(numTransfer))
+	// update sender, then receiver & set merkle proofs and roots in between
+	err = o.SetMerkleProofs(sender, senderAfter, receiver, receiverAfter, uint64(numTransfer))
 	if err != nil {
+		slog.Error("unable to set merkle proofs")
 		return err
 	}
 
 	// set transfer contraints
 	o.SetTxns(uint64(numTransfer), t)
+	o.witnesses.TxTypes[numTransfer] = circuit.TxTypeTransfer
+	o.setDeposit(uint64(numTransfer), deposit.Deposit{})
+	o.setWithdrawal(uint64(numTransfer), withdrawal.Record{})
+	o.fees = fees
 
-	slog.Info(fmt.Sprintf("sender account-%d balance before tx: %s", sender.Index, sender.Balance.String()))
-	slog.Info(fmt.Sprintf("sender account-%d balance after tx: %s", sender.Index, senderAfter.Balance.String()))
-	slog.Info(fmt.Sprintf("receiver account-%d balance before tx: %s", receiver.Index, receiver.Balance.String()))
-	slog.Info(fmt.Sprintf("receiver account-%d balance after tx: %s", receiver.Index, receiverAfter.Balance.String()))
+	token := t.TokenID
+	slog.Info(fmt.Sprintf("sender account-%d token-%d balance before tx: %s", sender.Index, token, sender.Balances[token].String()))
+	slog.Info(fmt.Sprintf("sender account-%d token-%d balance after tx: %s", sender.Index, token, senderAfter.Balances[token].String()))
+	slog.Info(fmt.Sprintf("receiver account-%d token-%d balance before tx: %s", receiver.Index, token, receiver.Balances[token].String()))
+	slog.Info(fmt.Sprintf("receiver account-%d token-%d balance after tx: %s", receiver.Index, token, receiverAfter.Balances[token].String()))
 
 	slog.Info("state updated successfully!!")
 
-	fmt.Println()
 	return nil
 
 }
@@ -191,7 +379,9 @@ func (o *Node) SetTxns(numTransfer uint64, t transfer.Transfer) {
 
 	// Convert uint64 to bytes
 	frNonce.SetUint64(t.Nonce)
+	o.witnesses.TransferTxs[numTransfer].TokenID = t.TokenID
 	o.witnesses.TransferTxs[numTransfer].Amount = t.Amount
+	o.witnesses.TransferTxs[numTransfer].Fee = t.Fee
 	o.witnesses.TransferTxs[numTransfer].Nonce = frNonce
 	o.witnesses.TransferTxs[numTransfer].SenderPubKey.A.X = t.SenderPubKey.A.X
 	o.witnesses.TransferTxs[numTransfer].SenderPubKey.A.Y = t.SenderPubKey.A.Y
@@ -202,81 +392,122 @@ func (o *Node) SetTxns(numTransfer uint64, t transfer.Transfer) {
 	o.witnesses.TransferTxs[numTransfer].Signature.S = t.Signature.S[:]
 }
 
-func (o *Node) UpdateAccounts(sender account.Account, receiver account.Account) {
-	o.hFunc.Reset()
-	senderBytes := sender.Marshal()
-	o.hFunc.Write(senderBytes)
-	hash := o.hFunc.Sum(nil)
-	copy(o.StateHash[sender.Index*uint64(o.hFunc.Size()):], hash)
-	copy(o.State[sender.Index*uint64(account.AccountSizeInBytes):], senderBytes)
+// write the account into the state, journaled if a state tx is open.
+// an account at the next empty leaf is added to the state
+func (o *Node) UpdateAccount(acc account.Account) {
+	if o.stateTx != nil {
+		o.stateTx.record(acc.Index)
+	}
+	o.updated[acc.Index] = struct{}{}
+	if acc.Index == uint64(o.nbAccounts) {
+		o.addAccount(acc)
+		return
+	}
+	o.writeAccount(acc.Index, acc.Marshal())
+}
 
-	o.hFunc.Reset()
-	receiverBytes := receiver.Marshal()
-	o.hFunc.Write(receiverBytes)
-	hash = o.hFunc.Sum(nil)
-	copy(o.StateHash[receiver.Index*uint64(o.hFunc.Size()):], hash)
-	copy(o.State[receiver.Index*uint64(account.AccountSizeInBytes):], receiverBytes)
+// append the account at the next empty leaf & register its pubkey
+func (o *Node) addAccount(acc account.Account) {
+	o.State = append(o.State, make([]byte, account.AccountSizeInBytes)...)
+	o.StateHash = append(o.StateHash, make([]byte, o.hFunc.Size())...)
+	o.nbAccounts++
+	o.writeAccount(acc.Index, acc.Marshal())
+	o.AccountMap[acc.Address()] = acc.Index
 }
 
-func (o *Node) SetMerkleProofs(before bool, sender account.Account, receiver account.Account, numTransfer uint64) error {
-	merkleRootBefore, senderInclusionProof, numLeaves, err := BuildProof(o.hFunc, o.StateHash, sender.Index)
+// remove the last account, its leaf is empty again
+func (o *Node) removeLastAccount() {
+	acc, err := o.ReadAccount(uint64(o.nbAccounts - 1))
 	if err != nil {
-		return err
+		panic(err)
 	}
+	delete(o.AccountMap, acc.Address())
 
-	err = VerifyProof(o.hFunc, merkleRootBefore, senderInclusionProof, sender.Index, numLeaves)
-	if err != nil {
-		return err
+	o.nbAccounts--
+	o.State = o.State[:o.nbAccounts*account.AccountSizeInBytes]
+	o.StateHash = o.StateHash[:o.nbAccounts*o.hFunc.Size()]
+	if err := o.tree.Set(acc.Index, make([]byte, o.hFunc.Size())); err != nil {
+		panic(err)
 	}
+}
 
-	slog.Info("sender inclusion proof is verified")
+func (o *Node) writeAccount(index uint64, accBytes []byte) {
+	o.hFunc.Reset()
+	o.hFunc.Write(accBytes)
+	hash := o.hFunc.Sum(nil)
+	copy(o.StateHash[index*uint64(o.hFunc.Size()):], hash)
+	copy(o.State[index*uint64(account.AccountSizeInBytes):], accBytes)
 
-	proof := GetMerkleProofFromBytes(merkleRootBefore, senderInclusionProof)
-	if before {
-		o.witnesses.MerkleProofsSenderBefore[numTransfer] = proof
-	} else {
-		o.witnesses.MerkleProofsSenderAfter[numTransfer] = proof
+	// index is always in the tree, as the tree holds all the accounts
+	if err := o.tree.Set(index, hash); err != nil {
+		panic(err)
 	}
+}
 
-	merkleRoot, receiverInclusionProof, numLeaves, err := BuildProof(o.hFunc, o.StateHash, receiver.Index)
+// merkle root of the current state
+func (o *Node) StateRoot() []byte {
+	return o.tree.Root()
+}
+
+// build and verify the merkle proof of the account at index against the current state
+func (o *Node) GetMerkleProof(index uint64) (merkle.MerkleProof, []byte, error) {
+	root := o.tree.Root()
+	inclusionProof, err := o.tree.Prove(index)
 	if err != nil {
-		return err
+		return merkle.MerkleProof{}, nil, err
 	}
 
-	if before {
-		o.witnesses.RootHashesBefore[numTransfer] = merkleRoot
-	} else {
-		o.witnesses.RootHashesAfter[numTransfer] = merkleRoot
+	err = VerifyProof(o.hFunc, root, inclusionProof, index, o.tree.NbLeaves())
+	if err != nil {
+		return merkle.MerkleProof{}, nil, err
 	}
 
-	err = VerifyProof(o.hFunc, merkleRoot, receiverInclusionProof, receiver.Index, numLeaves)
+	return GetMerkleProofFromBytes(root, inclusionProof), root, nil
+}
+
+// updates the state with senderAfter, then receiverAfter and sets the
+// merkle proofs & roots of every step in the witness
+//
+//	root before -> (sender updated) -> root intermediate -> (receiver updated) -> root after
+func (o *Node) SetMerkleProofs(sender, senderAfter, receiver, receiverAfter account.Account, numTransfer uint64) error {
+	proof, root, err := o.GetMerkleProof(sender.Index)
 	if err != nil {
 		return err
 	}
-	slog.Info("receiver inclusion proof is verified")
-
-	proof = GetMerkleProofFromBytes(merkleRoot, receiverInclusionProof)
+	o.witnesses.MerkleProofsSenderBefore[numTransfer] = proof
+	o.witnesses.RootHashesBefore[numTransfer] = root
+	if numTransfer == 0 {
+		o.witnesses.RootHashBefore = root
+	}
+	slog.Info("sender inclusion proof is verified")
 
-	if before {
-		o.witnesses.MerkleProofsReceiverBefore[numTransfer] = proof
+	o.UpdateAccount(senderAfter)
 
-	} else {
-		o.witnesses.MerkleProofsReceiverAfter[numTransfer] = proof
+	proof, root, err = o.GetMerkleProof(sender.Index)
+	if err != nil {
+		return err
 	}
+	o.witnesses.MerkleProofsSenderAfter[numTransfer] = proof
+	o.witnesses.RootHashesIntermediate[numTransfer] = root
 
-	return nil
-
-}
+	proof, _, err = o.GetMerkleProof(receiver.Index)
+	if err != nil {
+		return err
+	}
+	o.witnesses.MerkleProofsReceiverBefore[numTransfer] = proof
+	slog.Info("receiver inclusion proof is verified")
 
-func BuildProof(hFunc hash.Hash, data []byte, index uint64) ([]byte, [][]byte, uint64, error) {
-	var buf bytes.Buffer
+	o.UpdateAccount(receiverAfter)
 
-	_, err := buf.Write(data)
+	proof, root, err = o.GetMerkleProof(receiver.Index)
 	if err != nil {
-		return nil, nil, 0, err
+		return err
 	}
+	o.witnesses.MerkleProofsReceiverAfter[numTransfer] = proof
+	o.witnesses.RootHashesAfter[numTransfer] = root
+	o.witnesses.RootHashAfter = root
 
-	return merkletree.BuildReaderProof(&buf, hFunc, hFunc.Size(), index)
+	return nil
 }
 
 func GetMerkleProofFromBytes(rootBytes []byte, proofBytes [][]byte) merkle.MerkleProof {
@@ -297,13 +528,16 @@ func VerifyProof(hFunc hash.Hash, root []byte, proof [][]byte, index uint64, num
 	return nil
 }
 
-func (o *Node) VerifyAndGetAccount(accountKey string) (account.Account, error) {
-	senderIndex, ok := o.AccountMap[accountKey]
+func (o *Node) VerifyAndGetAccount(address account.Address) (account.Account, error) {
+	senderIndex, ok := o.AccountMap[address]
 	if !ok {
-		return account.Account{}, errors.New("account doesn't exist")
+		return account.Account{}, ErrUnknownAccount
 	}
 
-	senderAccount := o.ReadAccount(senderIndex)
+	senderAccount, err := o.ReadAccount(senderIndex)
+	if err != nil {
+		return account.Account{}, err
+	}
 
 	if senderAccount.Index != senderIndex {
 		return account.Account{}, errors.New("account index mismatch")
@@ -312,29 +546,73 @@ func (o *Node) VerifyAndGetAccount(accountKey string) (account.Account, error) {
 	return senderAccount, nil
 }
 
+// validates the transfer against the accounts with the same checks as the circuit,
+// and returns the updated accounts. Accounts are only updated once all the checks pass
 func VerifyAndGetUpdatedAccounts(
 	sender account.Account,
 	receiver account.Account,
 	t transfer.Transfer,
 	hFunc hash.Hash) (account.Account, account.Account, error) {
 
-	if sender.Balance.Cmp(&t.Amount) == -1 {
-		return account.Account{}, account.Account{}, errors.New("not enough balance")
+	// transfer should be from the sender to the receiver
+	if !t.SenderPubKey.A.Equal(&sender.PubKey.A) {
+		return account.Account{}, account.Account{}, fmt.Errorf("sender %w", ErrUnknownAccount)
+	}
+	if !t.ReceiverPubKey.A.Equal(&receiver.PubKey.A) {
+		return account.Account{}, account.Account{}, fmt.Errorf("receiver %w", ErrUnknownAccount)
 	}
-
-	sender.Balance = *sender.Balance.Sub(&sender.Balance, &t.Amount)
-	sender.Nonce = sender.Nonce + 1
-	receiver.Balance = *receiver.Balance.Add(&receiver.Balance, &t.Amount)
 
 	signed, err := signature.Verify(t.Message(hFunc), sender.PubKey, t.Signature.Bytes(), hFunc)
 	if err != nil {
-		return account.Account{}, account.Account{}, err
+		return account.Account{}, account.Account{}, fmt.Errorf("%w: %s", ErrBadSignature, err)
 	}
 	if !signed {
-		return account.Account{}, account.Account{}, errors.New("signature verification failed")
+		return account.Account{}, account.Account{}, ErrBadSignature
+	}
+
+	// transfer nonce should be the next nonce of the sender,
+	// so the same transfer can't be replayed and transfers are applied in order
+	if t.Nonce != sender.Nonce+1 {
+		return account.Account{}, account.Account{}, fmt.Errorf("%w: expected %d, got %d", ErrBadNonce, sender.Nonce+1, t.Nonce)
+	}
+
+	if t.TokenID >= account.NbTokens {
+		return account.Account{}, account.Account{}, ErrUnknownToken
+	}
+	senderBalance := &sender.Balances[t.TokenID]
+	receiverBalance := &receiver.Balances[t.TokenID]
+
+	// same range checks as the circuit
+	if !IsBalance(&t.Amount) || !IsBalance(&t.Fee) {
+		return account.Account{}, account.Account{}, ErrAmountOutOfRange
+	}
+	if !IsBalance(senderBalance) || !IsBalance(receiverBalance) {
+		return account.Account{}, account.Account{}, ErrBalanceOutOfRange
+	}
+
+	// sender pays the amount and the fee, the sum of two balances can't wrap around the field
+	var debit fr.Element
+	debit.Add(&t.Amount, &t.Fee)
+	if senderBalance.Cmp(&debit) == -1 {
+		return account.Account{}, account.Account{}, ErrInsufficientBalance
+	}
 
+	var credited fr.Element
+	credited.Add(receiverBalance, &t.Amount)
+	if !IsBalance(&credited) {
+		return account.Account{}, account.Account{}, ErrBalanceOverflow
 	}
 
+	senderBalance.Sub(senderBalance, &debit)
+	sender.Nonce = sender.Nonce + 1
+	*receiverBalance = credited
+
 	return sender, receiver, nil
 
 }
+
+// check if the value fits in circuit.BalanceBits bits
+func IsBalance(v *fr.Element) bool {
+	var b big.Int
+	return v.BigInt(&b).BitLen() <= circuit.BalanceBits
+}
@@ -0,0 +1,585 @@
+package node
+
+import (
+	"ZK-Rollup/account"
+	"ZK-Rollup/circuit"
+	"ZK-Rollup/config"
+	"ZK-Rollup/modules/deposit"
+	"ZK-Rollup/modules/transfer"
+	"ZK-Rollup/modules/withdrawal"
+	"ZK-Rollup/proofSystem"
+	"ZK-Rollup/signature"
+	"maps"
+	"math/big"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark-crypto/ecc/bn254/twistededwards/eddsa"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/test"
+	"github.com/stretchr/testify/assert"
+)
+
+var testConfig = config.Default()
+
+func newTestNode() (Node, map[uint64]SignatureAccount) {
+	accounts, data := NewRandomAccounts(uint64(testConfig.NbAccounts))
+	return NewNode(testConfig, data), accounts
+}
+
+func isSolved(assignment *circuit.Circuit) error {
+	cir := circuit.NewCircuit(testConfig)
+	return test.IsSolved(&cir, assignment, ecc.BN254.ScalarField())
+}
+
+// transfers from account 1 to account 2 filling a whole batch
+func fillBatch(t *testing.T, node *Node, accounts map[uint64]SignatureAccount, nonces []uint64) {
+	for i := 0; i < testConfig.BatchSize; i++ {
+		tx := transfer.NewTransfer(12, 0, accounts[1].PubKey, accounts[2].PubKey, nonces[i])
+		assert.NoError(t, tx.SetSign(hFunc2, accounts[1].PrivKey))
+		assert.NoError(t, node.UpdateState(tx, i))
+	}
+}
+
+func validNonces() []uint64 {
+	nonces := make([]uint64, testConfig.BatchSize)
+	for i := range nonces {
+		nonces[i] = uint64(i + 1)
+	}
+	return nonces
+}
+
+func TestUpdateStateWitness(t *testing.T) {
+	node, accounts := newTestNode()
+
+	rootBefore := node.StateRoot()
+
+	fillBatch(t, &node, accounts, validNonces())
+	assert.NoError(t, node.CreditFees())
+	assert.NoError(t, isSolved(&node.witnesses))
+
+	rootAfter := node.StateRoot()
+	assert.Equal(t, rootBefore, node.witnesses.RootHashBefore)
+	assert.Equal(t, rootAfter, node.witnesses.RootHashAfter)
+
+	// balances which are consistent with each other but not with the merkle leaves
+	tampered := node.witnesses.Clone()
+	senderAfter, err := node.ReadAccount(1)
+	assert.NoError(t, err)
+	extra := fr.NewElement(1000)
+	var balance fr.Element
+	balance.Add(&extra, &senderAfter.Balances[0])
+	tampered.SenderAccountsAfter[testConfig.BatchSize-1].Balances[0] = balance
+	amount := fr.NewElement(12)
+	balance.Add(&balance, &amount)
+	tampered.SenderAccountsBefore[testConfig.BatchSize-1].Balances[0] = balance
+	assert.Error(t, isSolved(&tampered))
+
+	// roots not chained
+	tampered = node.witnesses.Clone()
+	tampered.RootHashesBefore[1] = tampered.RootHashesBefore[0]
+	assert.Error(t, isSolved(&tampered))
+}
+
+func TestBadNonce(t *testing.T) {
+	node, accounts := newTestNode()
+
+	// nonce of a fresh account should be 1, not 5
+	tx := transfer.NewTransfer(12, 0, accounts[1].PubKey, accounts[2].PubKey, 5)
+	assert.NoError(t, tx.SetSign(hFunc2, accounts[1].PrivKey))
+	assert.ErrorIs(t, node.UpdateState(tx, 0), ErrBadNonce)
+
+	tx = transfer.NewTransfer(12, 0, accounts[1].PubKey, accounts[2].PubKey, 1)
+	assert.NoError(t, tx.SetSign(hFunc2, accounts[1].PrivKey))
+	assert.NoError(t, node.UpdateState(tx, 0))
+
+	// replayed transfer
+	assert.ErrorIs(t, node.UpdateState(tx, 1), ErrBadNonce)
+}
+
+// malicious prover applying a signed transfer from account 3 to 4 with nonce 5,
+// sender nonce in the tree is set to senderNonce before the batch
+func applyNonce5Transfer(t *testing.T, senderNonce uint64) *circuit.Circuit {
+	node, accounts := newTestNode()
+
+	tx := transfer.NewTransfer(12, 0, accounts[3].PubKey, accounts[4].PubKey, 5)
+	assert.NoError(t, tx.SetSign(hFunc2, accounts[3].PrivKey))
+
+	sender, err := node.ReadAccount(3)
+	assert.NoError(t, err)
+	receiver, err := node.ReadAccount(4)
+	assert.NoError(t, err)
+	sender.Nonce = senderNonce
+	node.UpdateAccount(sender)
+
+	senderAfter, receiverAfter := sender, receiver
+	senderAfter.Nonce++
+	senderAfter.Balances[0].Sub(&senderAfter.Balances[0], &tx.Amount)
+	receiverAfter.Balances[0].Add(&receiverAfter.Balances[0], &tx.Amount)
+
+	node.witnesses.SetBeforeAccounts(0, sender, receiver)
+	node.witnesses.SetAfterAccounts(0, senderAfter, receiverAfter)
+	assert.NoError(t, node.SetMerkleProofs(sender, senderAfter, receiver, receiverAfter, 0))
+	node.SetTxns(0, tx)
+	node.witnesses.TxTypes[0] = circuit.TxTypeTransfer
+	node.setDeposit(0, deposit.Deposit{})
+	node.setWithdrawal(0, withdrawal.Record{})
+
+	for i := 1; i < testConfig.BatchSize; i++ {
+		assert.NoError(t, node.SetNoop(i))
+	}
+	assert.NoError(t, node.CreditFees())
+
+	return &node.witnesses
+}
+
+func TestTransferNonceConstraint(t *testing.T) {
+	// sender nonce is incremented from 4 to 5
+	assert.NoError(t, isSolved(applyNonce5Transfer(t, 4)))
+
+	// sender nonce is 0 in the tree, so the transfer nonce should be 1
+	assert.Error(t, isSolved(applyNonce5Transfer(t, 0)))
+}
+
+func TestBalanceOverflow(t *testing.T) {
+	accounts, data := NewRandomAccounts(uint64(testConfig.NbAccounts))
+
+	// receiver balance is the max balance
+	var max big.Int
+	max.Lsh(big.NewInt(1), circuit.BalanceBits).Sub(&max, big.NewInt(1))
+	receiver := account.Account{Index: 2, PubKey: accounts[2].PubKey}
+	receiver.Balances[0].SetBigInt(&max)
+	assert.True(t, IsBalance(&receiver.Balances[0]))
+	copy(data[2*account.AccountSizeInBytes:], receiver.Marshal())
+
+	node := NewNode(testConfig, data)
+
+	tx := transfer.NewTransfer(12, 0, accounts[1].PubKey, accounts[2].PubKey, 1)
+	assert.NoError(t, tx.SetSign(hFunc2, accounts[1].PrivKey))
+	assert.ErrorIs(t, node.UpdateState(tx, 0), ErrBalanceOverflow)
+
+	// amount wrapping around the field
+	var amount fr.Element
+	amount.SetInt64(-1)
+	assert.False(t, IsBalance(&amount))
+}
+
+func TestNoopPadding(t *testing.T) {
+	node, accounts := newTestNode()
+
+	rootBefore := node.StateRoot()
+
+	tx := transfer.NewTransfer(12, 0, accounts[1].PubKey, accounts[2].PubKey, 1)
+	assert.NoError(t, tx.SetSign(hFunc2, accounts[1].PrivKey))
+	assert.NoError(t, node.UpdateState(tx, 0))
+
+	for i := 1; i < testConfig.BatchSize; i++ {
+		assert.NoError(t, node.SetNoop(i))
+	}
+	assert.NoError(t, node.CreditFees())
+	assert.NoError(t, isSolved(&node.witnesses))
+
+	rootAfter := node.StateRoot()
+	assert.NotEqual(t, rootBefore, rootAfter)
+	assert.Equal(t, rootAfter, node.witnesses.RootHashAfter)
+
+	// no-ops can't move funds
+	tampered := node.witnesses.Clone()
+	tampered.TransferTxs[1].Amount = 1
+	assert.Error(t, isSolved(&tampered))
+
+	// unsigned transfers are not no-ops
+	tampered = node.witnesses.Clone()
+	tampered.TxTypes[1] = circuit.TxTypeTransfer
+	assert.Error(t, isSolved(&tampered))
+}
+
+func TestSealBatchEmitsJob(t *testing.T) {
+	node, accounts := newTestNode()
+
+	genesisRoot := node.StateRoot()
+
+	tx := transfer.NewTransfer(12, 0, accounts[1].PubKey, accounts[2].PubKey, 1)
+	assert.NoError(t, tx.SetSign(hFunc2, accounts[1].PrivKey))
+	assert.NoError(t, node.UpdateState(tx, 0))
+	node.batch++
+
+	assert.NoError(t, node.SealBatch())
+	assert.Equal(t, 0, node.batch)
+
+	job := <-node.Jobs()
+	assert.Equal(t, uint64(1), job.BatchNumber)
+	assert.Equal(t, genesisRoot, job.RootBefore)
+	assert.NoError(t, isSolved(&job.Witness))
+
+	root := node.StateRoot()
+	assert.Equal(t, root, job.RootAfter)
+
+	// verifier rebuilds the same public witness from the roots
+	w, err := frontend.NewWitness(&job.Witness, ecc.BN254.ScalarField())
+	assert.NoError(t, err)
+	expected, err := w.Public()
+	assert.NoError(t, err)
+	publicWitness, err := proofSystem.PublicWitness(circuit.PublicInputs{
+		RootHashBefore: job.RootBefore,
+		RootHashAfter:  job.RootAfter,
+		Deposits:       job.Deposits,
+		Withdrawals:    job.Withdrawals,
+		BatchNumber:    job.BatchNumber,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, expected.Vector(), publicWitness.Vector())
+}
+
+func TestLightVerifierChain(t *testing.T) {
+	genesisRoot := []byte{1}
+	verifier := NewLightVerifier(nil, genesisRoot, 0)
+
+	err := verifier.VerifyBatch(BatchProof{BatchNumber: 2, RootBefore: genesisRoot})
+	assert.ErrorContains(t, err, "expected batch-1")
+
+	err = verifier.VerifyBatch(BatchProof{BatchNumber: 1, RootBefore: []byte{2}})
+	assert.ErrorContains(t, err, "latest verified root")
+
+	assert.Equal(t, genesisRoot, verifier.VerifiedRoot())
+
+	// verifier of a restarted node expects the batch after the last one
+	verifier = NewLightVerifier(nil, genesisRoot, 5)
+	err = verifier.VerifyBatch(BatchProof{BatchNumber: 1, RootBefore: genesisRoot})
+	assert.ErrorContains(t, err, "expected batch-6")
+}
+
+func TestRejectedTransfers(t *testing.T) {
+	node, accounts := newTestNode()
+	go node.ListenForTransfers()
+
+	_, unknownPubKey := signature.GenerateKeys(1000)
+
+	badSignature := transfer.NewTransfer(12, 0, accounts[1].PubKey, accounts[2].PubKey, 1)
+	assert.NoError(t, badSignature.SetSign(hFunc2, accounts[2].PrivKey))
+	assert.ErrorIs(t, node.SubmitTransfer(badSignature), ErrBadSignature)
+
+	unknownReceiver := transfer.NewTransfer(12, 0, accounts[1].PubKey, unknownPubKey, 1)
+	assert.NoError(t, unknownReceiver.SetSign(hFunc2, accounts[1].PrivKey))
+	assert.ErrorIs(t, node.SubmitTransfer(unknownReceiver), ErrUnknownAccount)
+
+	tooMuch := transfer.NewTransfer(1_000_000, 0, accounts[1].PubKey, accounts[2].PubKey, 1)
+	assert.NoError(t, tooMuch.SetSign(hFunc2, accounts[1].PrivKey))
+	assert.ErrorIs(t, node.SubmitTransfer(tooMuch), ErrInsufficientBalance)
+
+	selfTransfer := transfer.NewTransfer(12, 0, accounts[1].PubKey, accounts[1].PubKey, 1)
+	assert.NoError(t, selfTransfer.SetSign(hFunc2, accounts[1].PrivKey))
+	assert.ErrorIs(t, node.SubmitTransfer(selfTransfer), ErrSelfTransfer)
+
+	// node is still running
+	valid := transfer.NewTransfer(12, 0, accounts[1].PubKey, accounts[2].PubKey, 1)
+	assert.NoError(t, valid.SetSign(hFunc2, accounts[1].PrivKey))
+	assert.NoError(t, node.SubmitTransfer(valid))
+}
+
+func TestStateTxRollback(t *testing.T) {
+	node, accounts := newTestNode()
+
+	tx := transfer.NewTransfer(12, 0, accounts[1].PubKey, accounts[2].PubKey, 1)
+	assert.NoError(t, tx.SetSign(hFunc2, accounts[1].PrivKey))
+	assert.NoError(t, node.UpdateState(tx, 0))
+
+	state := append([]byte{}, node.State...)
+	stateHash := append([]byte{}, node.StateHash...)
+	witnesses := node.witnesses.Clone()
+	root := node.StateRoot()
+	updated := maps.Clone(node.updated)
+
+	// half applied transfer, account 2 is already updated in the batch, account 3 isn't
+	stateTx := node.Begin()
+	sender, err := node.ReadAccount(2)
+	assert.NoError(t, err)
+	sender.Nonce++
+	node.UpdateAccount(sender)
+	sender.Balances[0].SetUint64(1)
+	node.UpdateAccount(sender)
+	receiver, err := node.ReadAccount(3)
+	assert.NoError(t, err)
+	receiver.Balances[0].SetUint64(1)
+	node.UpdateAccount(receiver)
+	node.witnesses.SetBeforeAccounts(1, sender, receiver)
+	stateTx.Rollback()
+
+	rootAfterRollback := node.StateRoot()
+	assert.Equal(t, root, rootAfterRollback)
+	assert.Equal(t, state, node.State)
+	assert.Equal(t, stateHash, node.StateHash)
+	assert.Equal(t, witnesses, node.witnesses)
+	assert.Equal(t, updated, node.updated)
+
+	// rejected transfer leaves the state & witness unchanged
+	tooMuch := transfer.NewTransfer(1_000_000, 0, accounts[1].PubKey, accounts[2].PubKey, 2)
+	assert.NoError(t, tooMuch.SetSign(hFunc2, accounts[1].PrivKey))
+	assert.ErrorIs(t, node.UpdateState(tooMuch, 1), ErrInsufficientBalance)
+	assert.Equal(t, state, node.State)
+	assert.Equal(t, witnesses, node.witnesses)
+}
+
+func TestDeposit(t *testing.T) {
+	// half of the leaves are empty
+	accounts, data := NewRandomAccounts(uint64(testConfig.NbAccounts / 2))
+	node := NewNode(testConfig, data)
+	rootBefore := node.StateRoot()
+
+	privKey, pubKey := signature.GenerateKeys(1000)
+	d := deposit.NewDeposit(500, pubKey)
+	assert.NoError(t, node.ApplyDeposit(d, 0))
+
+	index := uint64(testConfig.NbAccounts / 2)
+	assert.Equal(t, index, node.AccountMap[account.AddressOf(pubKey)])
+	acc, err := node.ReadAccount(index)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(0), acc.Nonce)
+	assert.Equal(t, d.Amount, acc.Balances[0])
+
+	// already registered
+	assert.ErrorIs(t, node.ApplyDeposit(deposit.NewDeposit(1, accounts[1].PubKey), 1), ErrAccountExists)
+
+	// the identity & points off the curve are refused, the state is left unchanged
+	state := append([]byte{}, node.State...)
+	var invalid eddsa.PublicKey
+	assert.ErrorIs(t, node.ApplyDeposit(deposit.NewDeposit(1, invalid), 1), ErrInvalidPubKey)
+	invalid.A.Y.SetOne()
+	assert.ErrorIs(t, node.ApplyDeposit(deposit.NewDeposit(1, invalid), 1), ErrInvalidPubKey)
+	invalid.A.X.SetOne()
+	assert.ErrorIs(t, node.ApplyDeposit(deposit.NewDeposit(1, invalid), 1), ErrInvalidPubKey)
+	assert.Equal(t, state, node.State)
+
+	// new account can send funds in the same batch
+	tx := transfer.NewTransfer(12, 0, pubKey, accounts[1].PubKey, 1)
+	assert.NoError(t, tx.SetSign(hFunc2, privKey))
+	assert.NoError(t, node.UpdateState(tx, 1))
+
+	for i := 2; i < testConfig.BatchSize; i++ {
+		assert.NoError(t, node.SetNoop(i))
+	}
+	assert.NoError(t, node.CreditFees())
+	assert.NoError(t, isSolved(&node.witnesses))
+	assert.NotEqual(t, rootBefore, node.StateRoot())
+
+	// deposit should match the public inputs
+	tampered := node.witnesses.Clone()
+	tampered.Deposits[0].Amount = 501
+	assert.Error(t, isSolved(&tampered))
+
+	// deposits can't overwrite an account
+	tampered = node.witnesses.Clone()
+	tampered.TxTypes[2] = circuit.TxTypeDeposit
+	assert.Error(t, isSolved(&tampered))
+}
+
+func TestDepositRollback(t *testing.T) {
+	_, data := NewRandomAccounts(uint64(testConfig.NbAccounts - 1))
+	node := NewNode(testConfig, data)
+
+	state := append([]byte{}, node.State...)
+	root := node.StateRoot()
+
+	_, pubKey := signature.GenerateKeys(1000)
+	stateTx := node.Begin()
+	node.UpdateAccount(account.Account{Index: uint64(testConfig.NbAccounts - 1), PubKey: pubKey})
+	assert.NotEqual(t, root, node.StateRoot())
+	stateTx.Rollback()
+
+	assert.Equal(t, state, node.State)
+	assert.Equal(t, root, node.StateRoot())
+	assert.NotContains(t, node.AccountMap, account.AddressOf(pubKey))
+	assert.Empty(t, node.updated)
+
+	// last empty leaf
+	assert.NoError(t, node.ApplyDeposit(deposit.NewDeposit(1, pubKey), 0))
+	_, pubKey = signature.GenerateKeys(1001)
+	assert.ErrorIs(t, node.ApplyDeposit(deposit.NewDeposit(1, pubKey), 1), ErrStateFull)
+}
+
+func TestWithdrawal(t *testing.T) {
+	node, accounts := newTestNode()
+
+	recipient := fr.NewElement(0xbeef)
+	w := withdrawal.NewWithdrawal(100, accounts[1].PubKey, recipient, 1)
+	assert.NoError(t, w.SetSign(hFunc2, accounts[1].PrivKey))
+	assert.NoError(t, node.ApplyWithdrawal(w, 0))
+
+	acc, err := node.ReadAccount(1)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), acc.Nonce)
+	assert.Equal(t, fr.NewElement(2*666-100), acc.Balances[0])
+
+	// replayed withdrawal
+	assert.ErrorIs(t, node.ApplyWithdrawal(w, 1), ErrBadNonce)
+
+	tooMuch := withdrawal.NewWithdrawal(1_000_000, accounts[1].PubKey, recipient, 2)
+	assert.NoError(t, tooMuch.SetSign(hFunc2, accounts[1].PrivKey))
+	assert.ErrorIs(t, node.ApplyWithdrawal(tooMuch, 1), ErrInsufficientBalance)
+
+	tx := transfer.NewTransfer(12, 0, accounts[1].PubKey, accounts[2].PubKey, 2)
+	assert.NoError(t, tx.SetSign(hFunc2, accounts[1].PrivKey))
+	assert.NoError(t, node.UpdateState(tx, 1))
+	node.batch = 2
+
+	assert.NoError(t, node.SealBatch())
+	job := <-node.Jobs()
+	assert.NoError(t, isSolved(&job.Witness))
+
+	p := BatchProof{BatchNumber: job.BatchNumber, Withdrawals: job.Withdrawals}
+	assert.Equal(t, []withdrawal.Record{w.Record(1)}, p.WithdrawalRecords())
+
+	// the batch number of the records isn't public, it's the one of the proof
+	p.Withdrawals = append([]withdrawal.Record{}, job.Withdrawals...)
+	p.Withdrawals[0].BatchNumber = 0
+	p.Withdrawals[1].BatchNumber = 5
+	assert.Equal(t, []withdrawal.Record{w.Record(1)}, p.WithdrawalRecords())
+
+	// withdrawal should match the public outputs
+	tampered := job.Witness.Clone()
+	tampered.Withdrawals[0].Amount = 101
+	assert.Error(t, isSolved(&tampered))
+
+	tampered = job.Witness.Clone()
+	tampered.Withdrawals[0].Recipient = 0xdead
+	assert.Error(t, isSolved(&tampered))
+
+	// withdrawals can't be hidden in other slots
+	tampered = job.Witness.Clone()
+	tampered.Withdrawals[1].Recipient = 0xdead
+	assert.Error(t, isSolved(&tampered))
+
+	// signed withdrawal is not a transfer
+	tampered = job.Witness.Clone()
+	tampered.TxTypes[0] = circuit.TxTypeTransfer
+	assert.Error(t, isSolved(&tampered))
+}
+
+func TestFees(t *testing.T) {
+	node, accounts := newTestNode()
+
+	operator, err := node.ReadAccount(uint64(testConfig.Operator))
+	assert.NoError(t, err)
+
+	// sender can't pay the amount and the fee
+	sender, err := node.ReadAccount(1)
+	assert.NoError(t, err)
+	tx := transfer.NewTransfer(sender.Balances[0].Uint64(), 1, accounts[1].PubKey, accounts[2].PubKey, 1)
+	assert.NoError(t, tx.SetSign(hFunc2, accounts[1].PrivKey))
+	assert.ErrorIs(t, node.UpdateState(tx, 0), ErrInsufficientBalance)
+
+	for i := 0; i < 2; i++ {
+		tx := transfer.NewTransfer(12, 3, accounts[1].PubKey, accounts[2].PubKey, uint64(i+1))
+		assert.NoError(t, tx.SetSign(hFunc2, accounts[1].PrivKey))
+		assert.NoError(t, node.UpdateState(tx, i))
+	}
+	node.batch = 2
+
+	assert.NoError(t, node.SealBatch())
+	job := <-node.Jobs()
+	assert.NoError(t, isSolved(&job.Witness))
+
+	sender, err = node.ReadAccount(1)
+	assert.NoError(t, err)
+	assert.Equal(t, fr.NewElement(2*666-2*15), sender.Balances[0])
+	operatorAfter, err := node.ReadAccount(uint64(testConfig.Operator))
+	assert.NoError(t, err)
+	var fees fr.Element
+	fees.Sub(&operatorAfter.Balances[0], &operator.Balances[0])
+	assert.Equal(t, fr.NewElement(6), fees)
+	assert.Equal(t, node.StateRoot(), job.RootAfter)
+
+	// fee is signed
+	tampered := job.Witness.Clone()
+	tampered.TransferTxs[0].Fee = 4
+	assert.Error(t, isSolved(&tampered))
+
+	// operator can't be credited more than the fees
+	tampered = job.Witness.Clone()
+	operatorAfter.Balances[0].Add(&operatorAfter.Balances[0], &fees)
+	tampered.SetOperatorAccounts(operator, operatorAfter)
+	assert.Error(t, isSolved(&tampered))
+}
+
+func TestMultiAssetTransfer(t *testing.T) {
+	node, accounts := newTestNode()
+
+	unknown := transfer.NewTransfer(12, 0, accounts[1].PubKey, accounts[2].PubKey, 1)
+	unknown.TokenID = account.NbTokens
+	assert.NoError(t, unknown.SetSign(hFunc2, accounts[1].PrivKey))
+	assert.ErrorIs(t, node.UpdateState(unknown, 0), ErrUnknownToken)
+
+	tx := transfer.NewTransfer(12, 3, accounts[1].PubKey, accounts[2].PubKey, 1)
+	tx.TokenID = 2
+	assert.NoError(t, tx.SetSign(hFunc2, accounts[1].PrivKey))
+	assert.NoError(t, node.UpdateState(tx, 0))
+	node.batch++
+
+	assert.NoError(t, node.SealBatch())
+	job := <-node.Jobs()
+	assert.NoError(t, isSolved(&job.Witness))
+
+	// only the balances of token 2 are updated
+	sender, err := node.ReadAccount(1)
+	assert.NoError(t, err)
+	receiver, err := node.ReadAccount(2)
+	assert.NoError(t, err)
+	operator, err := node.ReadAccount(uint64(testConfig.Operator))
+	assert.NoError(t, err)
+	for k := 0; k < account.NbTokens; k++ {
+		if k == 2 {
+			continue
+		}
+		assert.Equal(t, fr.NewElement(2*666), sender.Balances[k])
+		assert.Equal(t, fr.NewElement(3*666), receiver.Balances[k])
+		assert.Equal(t, fr.NewElement(666), operator.Balances[k])
+	}
+	assert.Equal(t, fr.NewElement(2*666-15), sender.Balances[2])
+	assert.Equal(t, fr.NewElement(3*666+12), receiver.Balances[2])
+	assert.Equal(t, fr.NewElement(666+3), operator.Balances[2])
+
+	// token ID is signed
+	tampered := job.Witness.Clone()
+	tampered.TransferTxs[0].TokenID = 1
+	assert.Error(t, isSolved(&tampered))
+}
+
+func TestAccountAddress(t *testing.T) {
+	accounts, data := NewRandomAccounts(uint64(testConfig.NbAccounts / 2))
+
+	// (X, -Y) shares the X coordinate of account 1, but it's a distinct account
+	mirrored := accounts[1].PubKey
+	mirrored.A.Y.Neg(&mirrored.A.Y)
+	acc := account.Account{Index: uint64(testConfig.NbAccounts / 2), PubKey: mirrored}
+	node := NewNode(testConfig, append(append([]byte{}, data...), acc.Marshal()...))
+
+	assert.Equal(t, uint64(1), node.AccountMap[account.AddressOf(accounts[1].PubKey)])
+	assert.Equal(t, acc.Index, node.AccountMap[account.AddressOf(mirrored)])
+
+	// a pubkey can't be registered twice at genesis
+	acc.PubKey = accounts[1].PubKey
+	assert.Panics(t, func() { NewNode(testConfig, append(append([]byte{}, data...), acc.Marshal()...)) })
+}
+
+func TestExecuteBatch(t *testing.T) {
+	node, accounts := newTestNode()
+	rootBefore := node.StateRoot()
+
+	valid := transfer.NewTransfer(12, 1, accounts[1].PubKey, accounts[2].PubKey, 1)
+	assert.NoError(t, valid.SetSign(hFunc2, accounts[1].PrivKey))
+	replayed := valid
+
+	job, errs, err := node.ExecuteBatch([]any{valid, replayed})
+	assert.NoError(t, err)
+	assert.NoError(t, errs[0])
+	assert.ErrorIs(t, errs[1], ErrBadNonce)
+	assert.Equal(t, uint64(1), job.BatchNumber)
+	assert.Equal(t, rootBefore, job.RootBefore)
+	assert.Equal(t, node.StateRoot(), job.RootAfter)
+	assert.NoError(t, isSolved(&job.Witness))
+
+	_, _, err = node.ExecuteBatch([]any{replayed})
+	assert.Error(t, err)
+	assert.Equal(t, uint64(1), node.BatchCount)
+}
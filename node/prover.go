@@ -0,0 +1,121 @@
+package node
+
+import (
+	"ZK-Rollup/proofSystem"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// Prover backed by the groth16 proof system
+type ZkProver struct {
+	ps *proofSystem.ProofSystem
+}
+
+func NewZkProver(ps *proofSystem.ProofSystem) *ZkProver {
+	return &ZkProver{ps: ps}
+}
+
+func (p *ZkProver) Prove(job WitnessJob) (BatchProof, error) {
+	proof, _, err := p.ps.Prove(&job.Witness)
+	if err != nil {
+		return BatchProof{}, err
+	}
+
+	return BatchProof{
+		BatchNumber: job.BatchNumber,
+		Proof:       proof,
+		RootBefore:  job.RootBefore,
+		RootAfter:   job.RootAfter,
+		Deposits:    job.Deposits,
+		Withdrawals: job.Withdrawals,
+		StartTime:   job.StartTime,
+	}, nil
+}
+
+// proves the witness jobs concurrently with a number of workers,
+// the proofs are delivered in the same order as the jobs
+type ProverPool struct {
+	prover  Prover
+	workers int
+}
+
+func NewProverPool(prover Prover, workers int) *ProverPool {
+	if workers < 1 {
+		workers = 1
+	}
+	return &ProverPool{
+		prover:  prover,
+		workers: workers,
+	}
+}
+
+type proveResult struct {
+	batchNumber uint64
+	proof       BatchProof
+	err         error
+}
+
+type proveTask struct {
+	job    WitnessJob
+	result chan proveResult
+}
+
+// consumes witness jobs and emits their proofs in order, until jobs is closed.
+// A job is proven again on failure, up to ProveAttempts times. If it still fails, the later proofs
+// can't be verified, so the pool stops: proofs is closed and the error is returned
+func (p *ProverPool) Run(jobs <-chan WitnessJob, proofs chan<- BatchProof) error {
+	defer close(proofs)
+
+	tasks := make(chan proveTask)
+	// results of the jobs being proven, in the order of the jobs
+	pending := make(chan chan proveResult, p.workers)
+	stopped := make(chan struct{})
+	defer close(stopped)
+
+	for i := 0; i < p.workers; i++ {
+		go func() {
+			for task := range tasks {
+				proof, err := p.prove(task.job)
+				task.result <- proveResult{batchNumber: task.job.BatchNumber, proof: proof, err: err}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(pending)
+		defer close(tasks)
+
+		for job := range jobs {
+			result := make(chan proveResult, 1)
+			select {
+			case pending <- result:
+			case <-stopped:
+				return
+			}
+			tasks <- proveTask{job: job, result: result}
+		}
+	}()
+
+	for result := range pending {
+		res := <-result
+		if res.err != nil {
+			return fmt.Errorf("unable to prove batch-%d: %w", res.batchNumber, res.err)
+		}
+		proofs <- res.proof
+	}
+	return nil
+}
+
+// proves the job, up to ProveAttempts times
+func (p *ProverPool) prove(job WitnessJob) (BatchProof, error) {
+	for attempt := 1; ; attempt++ {
+		slog.Info(fmt.Sprintf("proving batch-%d", job.BatchNumber))
+		proof, err := p.prover.Prove(job)
+		if err == nil || attempt >= ProveAttempts {
+			return proof, err
+		}
+		slog.Warn(fmt.Sprintf("unable to prove batch-%d: %s, retrying in %s", job.BatchNumber, err, ProveRetryDelay))
+		time.Sleep(ProveRetryDelay)
+	}
+}
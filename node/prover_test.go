@@ -0,0 +1,86 @@
+package node
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// proves jobs with a random delay, fails on batch failBatch
+type mockProver struct {
+	failBatch uint64
+}
+
+func (p mockProver) Prove(job WitnessJob) (BatchProof, error) {
+	time.Sleep(time.Duration(rand.Intn(20)) * time.Millisecond)
+	if job.BatchNumber == p.failBatch {
+		return BatchProof{}, errors.New("prover failed")
+	}
+	return BatchProof{BatchNumber: job.BatchNumber}, nil
+}
+
+// fails the first attempt of every odd batch
+type flakyProver struct {
+	mu     sync.Mutex
+	failed map[uint64]bool
+}
+
+func (p *flakyProver) Prove(job WitnessJob) (BatchProof, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if job.BatchNumber%2 == 1 && !p.failed[job.BatchNumber] {
+		p.failed[job.BatchNumber] = true
+		return BatchProof{}, errors.New("prover failed")
+	}
+	return BatchProof{BatchNumber: job.BatchNumber}, nil
+}
+
+func runProverPool(prover Prover, nbJobs uint64) ([]uint64, error) {
+	jobs := make(chan WitnessJob)
+	proofs := make(chan BatchProof)
+	errc := make(chan error, 1)
+
+	go func() { errc <- NewProverPool(prover, 4).Run(jobs, proofs) }()
+	go func() {
+		defer close(jobs)
+		for i := uint64(1); i <= nbJobs; i++ {
+			select {
+			case jobs <- WitnessJob{BatchNumber: i}:
+			case <-time.After(time.Second):
+				// the pool stopped
+				return
+			}
+		}
+	}()
+
+	var got []uint64
+	for p := range proofs {
+		got = append(got, p.BatchNumber)
+	}
+	return got, <-errc
+}
+
+func TestProverPoolOrder(t *testing.T) {
+	delay := ProveRetryDelay
+	ProveRetryDelay = time.Millisecond
+	defer func() { ProveRetryDelay = delay }()
+
+	var expected []uint64
+	for i := uint64(1); i <= 20; i++ {
+		expected = append(expected, i)
+	}
+
+	// failed proofs are retried, in order
+	got, err := runProverPool(&flakyProver{failed: make(map[uint64]bool)}, 20)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, got)
+
+	// the pool stops at the batch which can't be proven
+	got, err = runProverPool(mockProver{failBatch: 7}, 20)
+	assert.ErrorContains(t, err, "unable to prove batch-7")
+	assert.Equal(t, expected[:6], got)
+}
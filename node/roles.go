@@ -0,0 +1,82 @@
+package node
+
+import (
+	"ZK-Rollup/circuit"
+	"ZK-Rollup/modules/deposit"
+	"ZK-Rollup/modules/withdrawal"
+	"time"
+
+	groth16 "github.com/consensys/gnark/backend/groth16"
+)
+
+// roles of the rollup:
+//
+//	Execution node (Node) --WitnessJob--> ZkNode (Prover) --BatchProof--> Light node (Verifier)
+
+// witness of a sealed batch, emitted by the execution node
+type WitnessJob struct {
+	BatchNumber uint64
+	Witness     circuit.Circuit
+	RootBefore  []byte              // state root before the batch
+	RootAfter   []byte              // state root after the batch
+	Deposits    []deposit.Deposit   // deposits of every slot, public inputs of the proof
+	Withdrawals []withdrawal.Record // withdrawals of every slot, public outputs of the proof
+	StartTime   time.Time           // time of the first tx of the batch
+}
+
+// public inputs of the proof of the batch
+func (j *WitnessJob) PublicInputs() circuit.PublicInputs {
+	return circuit.PublicInputs{
+		RootHashBefore: j.RootBefore,
+		RootHashAfter:  j.RootAfter,
+		Deposits:       j.Deposits,
+		Withdrawals:    j.Withdrawals,
+		BatchNumber:    j.BatchNumber,
+	}
+}
+
+// proof of a batch, emitted by the prover
+type BatchProof struct {
+	BatchNumber uint64
+	Proof       groth16.Proof
+	RootBefore  []byte
+	RootAfter   []byte
+	Deposits    []deposit.Deposit
+	Withdrawals []withdrawal.Record
+	StartTime   time.Time
+}
+
+func (p *BatchProof) PublicInputs() circuit.PublicInputs {
+	return circuit.PublicInputs{
+		RootHashBefore: p.RootBefore,
+		RootHashAfter:  p.RootAfter,
+		Deposits:       p.Deposits,
+		Withdrawals:    p.Withdrawals,
+		BatchNumber:    p.BatchNumber,
+	}
+}
+
+// withdrawals paid out by the batch, without the empty slots. Only the recipient, the token & the amount
+// are public inputs of the proof, the batch number of the records is the one of the proof
+func (p *BatchProof) WithdrawalRecords() []withdrawal.Record {
+	var records []withdrawal.Record
+	for _, w := range p.Withdrawals {
+		if w.Recipient.IsZero() && w.Amount.IsZero() {
+			continue
+		}
+		w.BatchNumber = p.BatchNumber
+		records = append(records, w)
+	}
+	return records
+}
+
+// creates zk proofs of the witness jobs
+type Prover interface {
+	Prove(job WitnessJob) (BatchProof, error)
+}
+
+// verifies the batch proofs against the public inputs
+type Verifier interface {
+	VerifyBatch(p BatchProof) error
+	VerifiedRoot() []byte // latest verified state root
+}
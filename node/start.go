@@ -2,8 +2,15 @@ package node
 
 import (
 	"ZK-Rollup/account"
+	"ZK-Rollup/config"
+	"ZK-Rollup/genesis"
 	"ZK-Rollup/modules/transfer"
+	"ZK-Rollup/proofSystem"
 	"ZK-Rollup/signature"
+	"ZK-Rollup/store"
+	"fmt"
+	"log"
+	"log/slog"
 	"math/rand"
 
 	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
@@ -18,8 +25,150 @@ type SignatureAccount struct {
 
 var hFunc2 = mimc.NewMiMC()
 
-func StartNodeWithRandomData(nbAccounts uint64, nbTransfers uint64) {
+func StartNodeWithRandomData(cfg config.Config, nbTransfers uint64) {
+	if err := cfg.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	nbAccounts := uint64(cfg.NbAccounts)
+
+	accountsMap, accountsBytes := NewRandomAccounts(nbAccounts)
+
+	node := NewNode(cfg, accountsBytes)
+
+	// compile the circuit & generate the keys once for all the batches,
+	// or load them from the previous run
+	ps, err := proofSystem.LoadOrNew(proofSystem.DefaultKeysDir, cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := runPipeline(&node, ps, nil); err != nil {
+		log.Fatal(err)
+	}
+	go DoRandomTransfers(&node, &accountsMap, nbTransfers, int(nbAccounts))
+
+	// blocking call
+	select {}
+
+}
+
+// default directory of the node store
+var DefaultDataDir = "data"
+
+// starts the node from the genesis, or from its store in dataDir if it was already started,
+// with the circuit & keys of keysDir (generated if missing).
+// prints the genesis state root and returns the running node & its store
+func StartNode(g genesis.Genesis, dataDir, keysDir string) (*Node, *store.Store, error) {
+	base, err := g.Snapshot()
+	if err != nil {
+		return nil, nil, err
+	}
+	fmt.Printf("genesis state root: %x\n", base.Root)
+
+	st, err := store.Open(dataDir, g.Params)
+	if err != nil {
+		return nil, nil, err
+	}
+	node, err := OpenNode(g.Params, st, base)
+	if err != nil {
+		st.Close()
+		return nil, nil, err
+	}
+
+	ps, err := proofSystem.LoadOrNew(keysDir, g.Params)
+	if err != nil {
+		st.Close()
+		return nil, nil, err
+	}
+
+	if err := runPipeline(&node, ps, st); err != nil {
+		st.Close()
+		return nil, nil, err
+	}
+	return &node, st, nil
+}
+
+// runs the execution node, the prover and the verifier, starting at the current state of the node.
+// proofs are saved into the store if not nil, the batches of the store which are not proven yet
+// are proven first and the verifier starts before them
+func runPipeline(node *Node, ps *proofSystem.ProofSystem, st *store.Store) error {
+	newVerifier := func(root []byte, batchNumber uint64) Verifier {
+		return NewLightVerifier(ps.VerifyingKey(), root, batchNumber)
+	}
+	return startPipeline(node, NewZkProver(ps), newVerifier, st)
+}
+
+// pipeline of the node with the prover, the verifier is built at the root after its first batch - 1
+func startPipeline(node *Node, prover Prover, newVerifier func(root []byte, batchNumber uint64) Verifier, st *store.Store) error {
+	var pending []WitnessJob
+	if st != nil {
+		var err error
+		if pending, err = PendingJobs(node.cfg, st); err != nil {
+			return err
+		}
+	}
+
+	batchNumber, root := node.BatchCount, node.StateRoot()
+	if len(pending) != 0 {
+		batchNumber, root = pending[0].BatchNumber-1, pending[0].RootBefore
+		slog.Info(fmt.Sprintf("proving batch-%d to batch-%d again", pending[0].BatchNumber, node.BatchCount))
+	}
+	verifier := newVerifier(root, batchNumber)
 
+	// pending jobs come before the batches sealed by the node
+	jobs := make(chan WitnessJob, MaxTxBuffer)
+	go func() {
+		for _, job := range pending {
+			jobs <- job
+		}
+		for job := range node.Jobs() {
+			jobs <- job
+		}
+	}()
+
+	proofs := make(chan BatchProof, MaxTxBuffer)
+
+	// execution node -> prover -> verifier
+	go node.ListenForTransfers()
+	go func(proofs chan<- BatchProof) {
+		// the batch can't be verified, nor the next ones. With a store, its job is kept
+		// and it's proven again when the node is restarted
+		if err := NewProverPool(prover, NbProverWorkers).Run(jobs, proofs); err != nil {
+			log.Fatal(err)
+		}
+	}(proofs)
+	if st != nil {
+		stored := make(chan BatchProof, MaxTxBuffer)
+		go StoreProofs(st, proofs, stored)
+		proofs = stored
+	}
+	go RunVerifier(verifier, proofs)
+	return nil
+}
+
+// genesis of the accounts of NewRandomAccounts, keys are deterministic
+func RandomGenesis(cfg config.Config, chainID uint64) genesis.Genesis {
+	pubKeys := make([]eddsa.PublicKey, cfg.NbAccounts)
+	for i := range pubKeys {
+		_, pubKeys[i] = signature.GenerateKeys(int64(i))
+	}
+	return NewGenesis(cfg, chainID, pubKeys)
+}
+
+// genesis of an account per pubkey, with the balances of NewRandomAccounts
+func NewGenesis(cfg config.Config, chainID uint64, pubKeys []eddsa.PublicKey) genesis.Genesis {
+	g := genesis.Genesis{
+		ChainID: chainID,
+		Params:  cfg,
+	}
+	for i, pubKey := range pubKeys {
+		g.Accounts = append(g.Accounts, genesis.AccountOf(newAccount(uint64(i), pubKey)))
+	}
+	return g
+}
+
+// generate nbAccounts accounts with deterministic keys, returns the keys and the state bytes
+func NewRandomAccounts(nbAccounts uint64) (map[uint64]SignatureAccount, []byte) {
 	accountsMap := make(map[uint64]SignatureAccount)
 	accountsBytes := make([]byte, nbAccounts*uint64(account.AccountSizeInBytes))
 
@@ -29,45 +178,48 @@ func StartNodeWithRandomData(nbAccounts uint64, nbTransfers uint64) {
 			PubKey:  pubKey,
 			PrivKey: privKey,
 		}
-		chainAccount := account.Account{
-			Index:   i,
-			Nonce:   0,
-			Balance: fr.NewElement((i + 1) * 666), // random balance
-			PubKey:  pubKey,
-		}
-
+		chainAccount := newAccount(i, pubKey)
 		accoutMarshalled := chainAccount.Marshal()
 
 		copy(accountsBytes[i*uint64(account.AccountSizeInBytes):], accoutMarshalled)
 	}
 
-	node := NewNode(int(nbAccounts), accountsBytes)
-
-	go node.ListenForTransfers()
-	go DoRandomTransfers(node, &accountsMap, nbTransfers, int(nbAccounts))
-
-	// blocking call
-	select {}
+	return accountsMap, accountsBytes
+}
 
+// account-i with the same balance of every token
+func newAccount(i uint64, pubKey eddsa.PublicKey) account.Account {
+	chainAccount := account.Account{
+		Index:  i,
+		Nonce:  0,
+		PubKey: pubKey,
+	}
+	for k := range chainAccount.Balances {
+		chainAccount.Balances[k] = fr.NewElement((i + 1) * 666) // random balance
+	}
+	return chainAccount
 }
 
-func DoRandomTransfers(node Node, accounts *map[uint64]SignatureAccount, numTransfers uint64, numAccounts int) {
+func DoRandomTransfers(node *Node, accounts *map[uint64]SignatureAccount, numTransfers uint64, numAccounts int) {
 	// make transactions from account one to account two
 
 	senderIndex := rand.Intn(numAccounts)
-	receiverIndex := rand.Intn(numAccounts)
+	// receiver should be different from sender
+	receiverIndex := (senderIndex + 1 + rand.Intn(numAccounts-1)) % numAccounts
 
 	account1 := (*accounts)[uint64(senderIndex)]
 	account2 := (*accounts)[uint64(receiverIndex)]
 
 	for i := uint64(0); i < numTransfers; i++ {
 
-		transfer := transfer.NewTransfer(12, account1.PubKey, account2.PubKey, i+1)
-		transfer.SetSign(hFunc2, account1.PrivKey)
-
-		// ok, err := transfer.VerifySignature(node.hFunc)
-
-		node.queue.txChannel <- transfer
+		transfer := transfer.NewTransfer(12, 1, account1.PubKey, account2.PubKey, i+1)
+		if err := transfer.SetSign(hFunc2, account1.PrivKey); err != nil {
+			slog.Error(fmt.Sprintf("unable to sign transfer: %s", err))
+			continue
+		}
 
+		if err := node.SubmitTransfer(transfer); err != nil {
+			slog.Error(fmt.Sprintf("transfer %d rejected: %s", i+1, err))
+		}
 	}
 }
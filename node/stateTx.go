@@ -0,0 +1,68 @@
+package node
+
+import (
+	"ZK-Rollup/account"
+	"ZK-Rollup/circuit"
+)
+
+// previous bytes of an updated account, nil if the account was added.
+// updated is true if the account was already updated in the batch
+type journalEntry struct {
+	index        uint64
+	accountBytes []byte
+	updated      bool
+}
+
+// state transaction: account updates are journaled until Commit or Rollback,
+// a rollback restores the state, state hashes and the pending witness
+type StateTx struct {
+	node      *Node
+	journal   []journalEntry
+	witnesses circuit.Circuit // pending witness at the start of the tx
+}
+
+// begin a state transaction, only one tx can be open at a time
+func (o *Node) Begin() *StateTx {
+	if o.stateTx != nil {
+		panic("state transaction already open")
+	}
+	o.stateTx = &StateTx{
+		node:      o,
+		witnesses: o.witnesses.Clone(),
+	}
+	return o.stateTx
+}
+
+// keep the updates
+func (tx *StateTx) Commit() {
+	tx.node.stateTx = nil
+}
+
+// undo the updates in reverse order & restore the pending witness
+func (tx *StateTx) Rollback() {
+	o := tx.node
+	o.stateTx = nil
+
+	for i := len(tx.journal) - 1; i >= 0; i-- {
+		if !tx.journal[i].updated {
+			delete(o.updated, tx.journal[i].index)
+		}
+		if tx.journal[i].accountBytes == nil {
+			o.removeLastAccount()
+			continue
+		}
+		o.writeAccount(tx.journal[i].index, tx.journal[i].accountBytes)
+	}
+	o.witnesses = tx.witnesses
+}
+
+func (tx *StateTx) record(index uint64) {
+	_, updated := tx.node.updated[index]
+	if index >= uint64(tx.node.nbAccounts) {
+		tx.journal = append(tx.journal, journalEntry{index: index, updated: updated})
+		return
+	}
+	accBytes := make([]byte, account.AccountSizeInBytes)
+	copy(accBytes, tx.node.State[index*uint64(account.AccountSizeInBytes):])
+	tx.journal = append(tx.journal, journalEntry{index: index, accountBytes: accBytes, updated: updated})
+}
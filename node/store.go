@@ -0,0 +1,162 @@
+package node
+
+import (
+	"ZK-Rollup/account"
+	"ZK-Rollup/config"
+	"ZK-Rollup/proofSystem"
+	"ZK-Rollup/snapshot"
+	"ZK-Rollup/store"
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+)
+
+// txs of the open batch are not sealed
+var ErrBatchOpen = errors.New("batch is open")
+
+// number of batches between two checkpoints of the store,
+// batches committed after the last checkpoint are replayed when the node is opened
+var CheckpointInterval uint64 = 16
+
+// node backed by the store, reopened at the last committed batch of the store.
+// The base snapshot (genesis or the state exported by another node) is only used,
+// and checkpointed, if the store is empty
+func OpenNode(cfg config.Config, st *store.Store, base snapshot.Snapshot) (Node, error) {
+	state, err := st.Recover()
+	if errors.Is(err, store.ErrEmpty) {
+		node, err := NewNodeFromSnapshot(cfg, base)
+		if err != nil {
+			return Node{}, err
+		}
+		node.store = st
+		return node, st.Checkpoint(node.storeState())
+	}
+	if err != nil {
+		return Node{}, err
+	}
+
+	node, err := newNode(cfg, state.Accounts, state.Tree)
+	if err != nil {
+		return Node{}, fmt.Errorf("%w: %s", store.ErrCorrupted, err)
+	}
+	node.store = st
+	node.BatchCount = state.BatchNumber
+	node.newBatch()
+	slog.Info(fmt.Sprintf("state recovered at batch-%d, root %x", node.BatchCount, node.StateRoot()))
+
+	return node, nil
+}
+
+// in-memory node bootstrapped from the snapshot, the next batch follows the batch of the snapshot.
+// The state root of the accounts should be the root of the snapshot
+func NewNodeFromSnapshot(cfg config.Config, s snapshot.Snapshot) (Node, error) {
+	node, err := newNode(cfg, append([]byte{}, s.Accounts...), nil)
+	if err != nil {
+		return Node{}, err
+	}
+	if !bytes.Equal(node.StateRoot(), s.Root) {
+		return Node{}, snapshot.ErrRootMismatch
+	}
+	node.BatchCount = s.BatchNumber
+	node.newBatch()
+	return node, nil
+}
+
+// snapshot of the state after the last sealed batch, txs of the open batch are not sealed yet
+func (o *Node) Snapshot() (snapshot.Snapshot, error) {
+	if o.batch != 0 {
+		return snapshot.Snapshot{}, ErrBatchOpen
+	}
+	return snapshot.Snapshot{
+		BatchNumber: o.BatchCount,
+		Root:        o.StateRoot(),
+		Accounts:    append([]byte{}, o.State...),
+	}, nil
+}
+
+// state after the last sealed batch
+func (o *Node) storeState() store.State {
+	return store.State{
+		BatchNumber: o.BatchCount,
+		Accounts:    o.State,
+		Tree:        o.tree,
+	}
+}
+
+// commit the accounts updated by the batch being sealed to the store,
+// and checkpoint the state every CheckpointInterval batches.
+// The witness job is saved first, so a committed batch can be proven after a crash
+func (o *Node) commitBatch(job WitnessJob) error {
+	if o.store == nil {
+		return nil
+	}
+
+	data, err := encodeJob(job)
+	if err != nil {
+		return err
+	}
+	if err := o.store.PutJob(job.BatchNumber, data); err != nil {
+		return err
+	}
+
+	publicWitness, err := proofSystem.PublicWitness(job.PublicInputs())
+	if err != nil {
+		return err
+	}
+	publicWitnessBytes, err := publicWitness.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	b := store.Batch{
+		Number:        job.BatchNumber,
+		RootBefore:    job.RootBefore,
+		RootAfter:     job.RootAfter,
+		NbAccounts:    uint64(o.nbAccounts),
+		PublicWitness: publicWitnessBytes,
+	}
+	indexes := make([]uint64, 0, len(o.updated))
+	for index := range o.updated {
+		// accounts added & rolled back are not in the state anymore
+		if index < uint64(o.nbAccounts) {
+			indexes = append(indexes, index)
+		}
+	}
+	sort.Slice(indexes, func(i, j int) bool { return indexes[i] < indexes[j] })
+	for _, index := range indexes {
+		b.Updates = append(b.Updates, store.AccountUpdate{Index: index, Bytes: o.accountBytes(index)})
+	}
+
+	if err := o.store.CommitBatch(b); err != nil {
+		return err
+	}
+
+	// the batch is already in the log, a failed checkpoint is retried with the next one
+	if b.Number%CheckpointInterval == 0 {
+		state := o.storeState()
+		state.BatchNumber = b.Number
+		if err := o.store.Checkpoint(state); err != nil {
+			slog.Error(fmt.Sprintf("unable to checkpoint batch-%d: %s", b.Number, err))
+		}
+	}
+	return nil
+}
+
+// copy of the account bytes at index
+func (o *Node) accountBytes(index uint64) []byte {
+	size := uint64(account.AccountSizeInBytes)
+	return append([]byte{}, o.State[index*size:(index+1)*size]...)
+}
+
+// saves the proofs into the store & forwards them, until proofs is closed
+func StoreProofs(st *store.Store, proofs <-chan BatchProof, out chan<- BatchProof) {
+	defer close(out)
+	for p := range proofs {
+		if err := st.PutProof(p.BatchNumber, p.Proof); err != nil {
+			slog.Error(fmt.Sprintf("unable to store proof of batch-%d: %s", p.BatchNumber, err))
+		}
+		out <- p
+	}
+}
@@ -0,0 +1,293 @@
+package node
+
+import (
+	"ZK-Rollup/account"
+	"ZK-Rollup/modules/deposit"
+	"ZK-Rollup/modules/transfer"
+	"ZK-Rollup/signature"
+	"ZK-Rollup/snapshot"
+	"ZK-Rollup/store"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/stretchr/testify/assert"
+)
+
+// seal a batch with a single transfer from account 1 to account 2
+func sealTransfer(t *testing.T, node *Node, accounts map[uint64]SignatureAccount, nonce uint64) {
+	tx := transfer.NewTransfer(12, 1, accounts[1].PubKey, accounts[2].PubKey, nonce)
+	assert.NoError(t, tx.SetSign(hFunc2, accounts[1].PrivKey))
+	assert.NoError(t, node.UpdateState(tx, node.batch))
+	node.batch++
+	assert.NoError(t, node.SealBatch())
+	<-node.Jobs()
+}
+
+func TestOpenNodeRecovery(t *testing.T) {
+	defer func(interval uint64) { CheckpointInterval = interval }(CheckpointInterval)
+	CheckpointInterval = 2
+
+	dir := t.TempDir()
+	accounts, genesis := NewRandomAccounts(uint64(testConfig.NbAccounts / 2))
+
+	base, err := snapshot.New(testConfig, 0, genesis)
+	assert.NoError(t, err)
+	st, err := store.Open(dir, testConfig)
+	assert.NoError(t, err)
+	node, err := OpenNode(testConfig, st, base)
+	assert.NoError(t, err)
+
+	// batch-1 registers an account, batch-2 is checkpointed, batch-3 is replayed from the log
+	_, pubKey := signature.GenerateKeys(1000)
+	assert.NoError(t, node.ApplyDeposit(deposit.NewDeposit(5, pubKey), 0))
+	node.batch++
+	assert.NoError(t, node.SealBatch())
+	<-node.Jobs()
+	sealTransfer(t, &node, accounts, 1)
+	sealTransfer(t, &node, accounts, 2)
+
+	root := node.StateRoot()
+	state := append([]byte{}, node.State...)
+
+	// txs of the open batch are lost in the crash
+	tx := transfer.NewTransfer(12, 1, accounts[1].PubKey, accounts[2].PubKey, 3)
+	assert.NoError(t, tx.SetSign(hFunc2, accounts[1].PrivKey))
+	assert.NoError(t, node.UpdateState(tx, 0))
+	assert.NoError(t, st.Close())
+
+	st, err = store.Open(dir, testConfig)
+	assert.NoError(t, err)
+	defer st.Close()
+	recovered, err := OpenNode(testConfig, st, base)
+	assert.NoError(t, err)
+
+	assert.Equal(t, uint64(3), recovered.BatchCount)
+	assert.Equal(t, root, recovered.StateRoot())
+	assert.Equal(t, state, recovered.State)
+	assert.Equal(t, uint64(testConfig.NbAccounts/2), recovered.AccountMap[account.AddressOf(pubKey)])
+
+	sender, err := recovered.ReadAccount(1)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), sender.Nonce)
+
+	// the recovered node keeps sealing batches after the last committed one
+	sealTransfer(t, &recovered, accounts, 3)
+	b, err := st.Batch(4)
+	assert.NoError(t, err)
+	assert.Equal(t, root, b.RootBefore)
+	assert.Equal(t, recovered.StateRoot(), b.RootAfter)
+}
+
+func TestSnapshotBootstrap(t *testing.T) {
+	defer func(interval uint64) { CheckpointInterval = interval }(CheckpointInterval)
+	CheckpointInterval = 2
+
+	accounts, genesis := NewRandomAccounts(uint64(testConfig.NbAccounts))
+	base, err := snapshot.New(testConfig, 0, genesis)
+	assert.NoError(t, err)
+	st, err := store.Open(t.TempDir(), testConfig)
+	assert.NoError(t, err)
+	defer st.Close()
+	node, err := OpenNode(testConfig, st, base)
+	assert.NoError(t, err)
+
+	sealTransfer(t, &node, accounts, 1)
+	rootAfter1 := node.StateRoot()
+	sealTransfer(t, &node, accounts, 2)
+	sealTransfer(t, &node, accounts, 3)
+
+	// batch-1 is before the checkpoint, replayed from the base of the store
+	s, err := snapshot.FromStore(st, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, rootAfter1, s.Root)
+	_, err = snapshot.FromStore(st, 4)
+	assert.ErrorIs(t, err, store.ErrNotFound)
+
+	s, err = snapshot.FromStore(st, 3)
+	assert.NoError(t, err)
+	expected, err := node.Snapshot()
+	assert.NoError(t, err)
+	assert.Equal(t, expected, s)
+
+	// fresh node from the snapshot, without the batches before it
+	decoded, err := snapshot.Decode(testConfig, s.Encode(testConfig))
+	assert.NoError(t, err)
+	bootstrapped, err := NewNodeFromSnapshot(testConfig, decoded)
+	assert.NoError(t, err)
+	assert.Equal(t, node.StateRoot(), bootstrapped.StateRoot())
+	assert.Equal(t, uint64(3), bootstrapped.BatchCount)
+
+	sealTransfer(t, &bootstrapped, accounts, 4)
+	sealTransfer(t, &node, accounts, 4)
+	assert.Equal(t, node.StateRoot(), bootstrapped.StateRoot())
+
+	decoded.Root = rootAfter1
+	_, err = NewNodeFromSnapshot(testConfig, decoded)
+	assert.ErrorIs(t, err, snapshot.ErrRootMismatch)
+
+	// open batch
+	tx := transfer.NewTransfer(12, 1, accounts[1].PubKey, accounts[2].PubKey, 5)
+	assert.NoError(t, tx.SetSign(hFunc2, accounts[1].PrivKey))
+	assert.NoError(t, node.UpdateState(tx, 0))
+	node.batch++
+	_, err = node.Snapshot()
+	assert.ErrorIs(t, err, ErrBatchOpen)
+}
+
+func TestRandomGenesis(t *testing.T) {
+	g := RandomGenesis(testConfig, 1)
+	assert.NoError(t, g.Validate())
+
+	// same state as the simulation
+	node, _ := newTestNode()
+	root, err := g.Root()
+	assert.NoError(t, err)
+	assert.Equal(t, node.StateRoot(), root)
+}
+
+// proves the jobs with an empty proof
+type emptyProver struct{}
+
+func (emptyProver) Prove(job WitnessJob) (BatchProof, error) {
+	return BatchProof{
+		BatchNumber: job.BatchNumber,
+		Proof:       groth16.NewProof(ecc.BN254),
+		RootBefore:  job.RootBefore,
+		RootAfter:   job.RootAfter,
+		StartTime:   job.StartTime,
+	}, nil
+}
+
+// checks that the batches are chained as the light verifier does, without the proofs.
+// verified gets the number of every verified batch, 0 for a rejected batch
+type chainVerifier struct {
+	root        []byte
+	batchNumber uint64
+	verified    chan uint64
+}
+
+func (v *chainVerifier) VerifyBatch(p BatchProof) error {
+	if p.BatchNumber != v.batchNumber+1 || !bytes.Equal(p.RootBefore, v.root) {
+		v.verified <- 0
+		return errors.New("batch out of chain")
+	}
+	v.root, v.batchNumber = p.RootAfter, p.BatchNumber
+	v.verified <- p.BatchNumber
+	return nil
+}
+
+func (v *chainVerifier) VerifiedRoot() []byte {
+	return v.root
+}
+
+func TestPipelineRestart(t *testing.T) {
+	defer func(timeout time.Duration) { BatchTimeout = timeout }(BatchTimeout)
+	BatchTimeout = 10 * time.Millisecond
+
+	dir := t.TempDir()
+	accounts, genesis := NewRandomAccounts(uint64(testConfig.NbAccounts))
+	base, err := snapshot.New(testConfig, 0, genesis)
+	assert.NoError(t, err)
+	st, err := store.Open(dir, testConfig)
+	assert.NoError(t, err)
+	node, err := OpenNode(testConfig, st, base)
+	assert.NoError(t, err)
+
+	// batch-1 is proven, the node crashes before batch-2 is proven
+	sealTransfer(t, &node, accounts, 1)
+	assert.NoError(t, st.PutProof(1, groth16.NewProof(ecc.BN254)))
+	rootAfter1 := node.StateRoot()
+	sealTransfer(t, &node, accounts, 2)
+	assert.NoError(t, st.Close())
+
+	st, err = store.Open(dir, testConfig)
+	assert.NoError(t, err)
+	defer st.Close()
+	restarted, err := OpenNode(testConfig, st, base)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), restarted.BatchCount)
+
+	// the job of batch-2 is recovered with the same witness
+	pending, err := PendingJobs(testConfig, st)
+	assert.NoError(t, err)
+	if assert.Len(t, pending, 1) {
+		assert.Equal(t, uint64(2), pending[0].BatchNumber)
+		assert.Equal(t, rootAfter1, pending[0].RootBefore)
+		assert.NoError(t, isSolved(&pending[0].Witness))
+	}
+
+	verifier := &chainVerifier{verified: make(chan uint64, 2)}
+	newVerifier := func(root []byte, batchNumber uint64) Verifier {
+		verifier.root, verifier.batchNumber = root, batchNumber
+		return verifier
+	}
+	assert.NoError(t, startPipeline(&restarted, emptyProver{}, newVerifier, st))
+
+	// batch-2 is proven again, then the batches sealed after the restart
+	assert.Equal(t, uint64(2), <-verifier.verified)
+	tx := transfer.NewTransfer(12, 1, accounts[1].PubKey, accounts[2].PubKey, 3)
+	assert.NoError(t, tx.SetSign(hFunc2, accounts[1].PrivKey))
+	assert.NoError(t, restarted.SubmitTransfer(tx))
+	assert.Equal(t, uint64(3), <-verifier.verified)
+
+	assert.Eventually(t, func() bool {
+		_, err := st.Proof(3)
+		return err == nil
+	}, time.Second, time.Millisecond)
+	_, err = st.Proof(2)
+	assert.NoError(t, err)
+	numbers, err := st.PendingJobs()
+	assert.NoError(t, err)
+	assert.Empty(t, numbers)
+}
+
+func TestSealFailure(t *testing.T) {
+	defer func(timeout time.Duration) { BatchTimeout = timeout }(BatchTimeout)
+	BatchTimeout = 10 * time.Millisecond
+
+	dir := t.TempDir()
+	accounts, genesis := NewRandomAccounts(uint64(testConfig.NbAccounts))
+	base, err := snapshot.New(testConfig, 0, genesis)
+	assert.NoError(t, err)
+	st, err := store.Open(dir, testConfig)
+	assert.NoError(t, err)
+	defer st.Close()
+	node, err := OpenNode(testConfig, st, base)
+	assert.NoError(t, err)
+	go node.ListenForTransfers()
+
+	// jobs can't be saved while a file is in the place of the jobs directory
+	jobsDir := filepath.Join(dir, store.JobsDir)
+	assert.NoError(t, os.WriteFile(jobsDir, nil, 0o644))
+
+	submit := func(nonce uint64) error {
+		tx := transfer.NewTransfer(12, 1, accounts[1].PubKey, accounts[2].PubKey, nonce)
+		assert.NoError(t, tx.SetSign(hFunc2, accounts[1].PrivKey))
+		return node.SubmitTransfer(tx)
+	}
+	for nonce := uint64(1); nonce <= uint64(testConfig.BatchSize); nonce++ {
+		assert.NoError(t, submit(nonce))
+	}
+
+	// the full batch isn't sealed, next txs are rejected
+	nonce := uint64(testConfig.BatchSize) + 1
+	assert.ErrorIs(t, submit(nonce), ErrBatchFull)
+	var batchCount uint64
+	node.View(func() { batchCount = node.BatchCount })
+	assert.Equal(t, uint64(0), batchCount)
+	assert.Equal(t, uint64(0), st.LastBatch())
+
+	// the batch is sealed with its txs once the store can be written again
+	assert.NoError(t, os.Remove(jobsDir))
+	job := <-node.Jobs()
+	assert.Equal(t, uint64(1), job.BatchNumber)
+	assert.NoError(t, isSolved(&job.Witness))
+	assert.Equal(t, uint64(1), st.LastBatch())
+	assert.NoError(t, submit(nonce))
+}
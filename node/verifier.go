@@ -0,0 +1,87 @@
+package node
+
+import (
+	"ZK-Rollup/modules/withdrawal"
+	"ZK-Rollup/proofSystem"
+	"bytes"
+	"fmt"
+	"log/slog"
+	"time"
+
+	groth16 "github.com/consensys/gnark/backend/groth16"
+)
+
+// Verifier which only keeps the verifying key and the latest verified state root
+type LightVerifier struct {
+	vk          groth16.VerifyingKey
+	root        []byte              // latest verified state root
+	batchNumber uint64              // latest verified batch
+	withdrawals []withdrawal.Record // withdrawals of the verified batches, to be paid out on L1
+}
+
+// verifier of the batches after batchNumber, starting at the root after batchNumber
+// (the genesis root and 0 for a new chain)
+func NewLightVerifier(vk groth16.VerifyingKey, root []byte, batchNumber uint64) *LightVerifier {
+	return &LightVerifier{
+		vk:          vk,
+		root:        root,
+		batchNumber: batchNumber,
+	}
+}
+
+// verifies the proof of the next batch, which should start at the latest verified root
+func (v *LightVerifier) VerifyBatch(p BatchProof) error {
+	if p.BatchNumber != v.batchNumber+1 {
+		return fmt.Errorf("expected batch-%d, got batch-%d", v.batchNumber+1, p.BatchNumber)
+	}
+
+	if !bytes.Equal(p.RootBefore, v.root) {
+		return fmt.Errorf("batch-%d doesn't start at the latest verified root", p.BatchNumber)
+	}
+
+	publicWitness, err := proofSystem.PublicWitness(p.PublicInputs())
+	if err != nil {
+		return err
+	}
+
+	if err := proofSystem.VerifyProof(v.vk, p.Proof, publicWitness); err != nil {
+		return err
+	}
+
+	v.root = p.RootAfter
+	v.batchNumber = p.BatchNumber
+	v.withdrawals = append(v.withdrawals, p.WithdrawalRecords()...)
+
+	return nil
+}
+
+func (v *LightVerifier) VerifiedRoot() []byte {
+	return v.root
+}
+
+// withdrawals of the verified batches
+func (v *LightVerifier) Withdrawals() []withdrawal.Record {
+	return v.withdrawals
+}
+
+// consumes batch proofs and verifies them, until proofs is closed
+func RunVerifier(verifier Verifier, proofs <-chan BatchProof) {
+	for p := range proofs {
+		if err := verifier.VerifyBatch(p); err != nil {
+			slog.Error(fmt.Sprintf("batch-%d rejected: %s", p.BatchNumber, err))
+			continue
+		}
+
+		fmt.Println()
+		fmt.Println("---------------- Batch-", p.BatchNumber, "Zk Proof Verified! -------------------")
+		slog.Info(fmt.Sprintf("verified state root: %x", verifier.VerifiedRoot()))
+		for _, w := range p.WithdrawalRecords() {
+			slog.Info(fmt.Sprintf("withdrawal of %s to %s", w.Amount.String(), w.Recipient.String()))
+		}
+
+		timeInSeconds := time.Since(p.StartTime).Seconds()
+		slog.Info(fmt.Sprintln("Time taken for complete batch life cycle:", timeInSeconds, "seconds!"))
+		fmt.Println()
+		fmt.Println()
+	}
+}
@@ -0,0 +1,110 @@
+package node
+
+import (
+	"ZK-Rollup/account"
+	"ZK-Rollup/circuit"
+	"ZK-Rollup/modules/deposit"
+	"ZK-Rollup/modules/transfer"
+	"ZK-Rollup/modules/withdrawal"
+	"fmt"
+	"hash"
+	"log/slog"
+)
+
+// debits the account + build witness of zk circuit, the withdrawal is a public output of the batch
+// the state and the witness are left unchanged if the withdrawal is rejected
+func (o *Node) ApplyWithdrawal(w withdrawal.Withdrawal, numTransfer int) error {
+	stateTx := o.Begin()
+	if err := o.applyWithdrawal(w, numTransfer); err != nil {
+		stateTx.Rollback()
+		return err
+	}
+	stateTx.Commit()
+	return nil
+}
+
+// withdrawals use the debited account as the sender,
+// and the same account as the receiver, which is left unchanged after the debit
+func (o *Node) applyWithdrawal(w withdrawal.Withdrawal, numTransfer int) error {
+	acc, err := o.VerifyAndGetAccount(account.AddressOf(w.PubKey))
+	if err != nil {
+		return err
+	}
+
+	accAfter, err := VerifyAndGetWithdrawnAccount(acc, w, o.hFunc)
+	if err != nil {
+		return err
+	}
+
+	o.witnesses.SetBeforeAccounts(uint64(numTransfer), acc, accAfter)
+	o.witnesses.SetAfterAccounts(uint64(numTransfer), accAfter, accAfter)
+
+	err = o.SetMerkleProofs(acc, accAfter, accAfter, accAfter, uint64(numTransfer))
+	if err != nil {
+		return err
+	}
+
+	t := transfer.Transfer{
+		Nonce:          w.Nonce,
+		TokenID:        w.TokenID,
+		Amount:         w.Amount,
+		SenderPubKey:   w.PubKey,
+		ReceiverPubKey: w.PubKey,
+		Signature:      w.Signature,
+	}
+
+	o.SetTxns(uint64(numTransfer), t)
+	o.witnesses.TxTypes[numTransfer] = circuit.TxTypeWithdrawal
+	o.setDeposit(uint64(numTransfer), deposit.Deposit{})
+	o.setWithdrawal(uint64(numTransfer), w.Record(o.BatchCount+1))
+
+	slog.Info(fmt.Sprintf("account-%d withdrew %s of token-%d", acc.Index, w.Amount.String(), w.TokenID))
+
+	return nil
+}
+
+// validates the withdrawal against the account with the same checks as the circuit,
+// and returns the debited account
+func VerifyAndGetWithdrawnAccount(acc account.Account, w withdrawal.Withdrawal, hFunc hash.Hash) (account.Account, error) {
+	if !w.PubKey.A.Equal(&acc.PubKey.A) {
+		return account.Account{}, ErrUnknownAccount
+	}
+
+	signed, err := w.VerifySignature(hFunc)
+	if err != nil {
+		return account.Account{}, fmt.Errorf("%w: %s", ErrBadSignature, err)
+	}
+	if !signed {
+		return account.Account{}, ErrBadSignature
+	}
+
+	if w.Nonce != acc.Nonce+1 {
+		return account.Account{}, fmt.Errorf("%w: expected %d, got %d", ErrBadNonce, acc.Nonce+1, w.Nonce)
+	}
+
+	if w.TokenID >= account.NbTokens {
+		return account.Account{}, ErrUnknownToken
+	}
+	balance := &acc.Balances[w.TokenID]
+
+	if !IsBalance(&w.Amount) {
+		return account.Account{}, ErrAmountOutOfRange
+	}
+	if !IsBalance(balance) {
+		return account.Account{}, ErrBalanceOutOfRange
+	}
+	if balance.Cmp(&w.Amount) == -1 {
+		return account.Account{}, ErrInsufficientBalance
+	}
+
+	balance.Sub(balance, &w.Amount)
+	acc.Nonce = acc.Nonce + 1
+
+	return acc, nil
+}
+
+// set the withdrawal of the slot, in the witness and in the public outputs of the batch
+func (o *Node) setWithdrawal(numTransfer uint64, w withdrawal.Record) {
+	o.withdrawals[numTransfer] = w
+	o.witnesses.SetWithdrawal(numTransfer, w)
+}
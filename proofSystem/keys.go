@@ -0,0 +1,148 @@
+package proofSystem
+
+import (
+	"ZK-Rollup/circuit"
+	"ZK-Rollup/config"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	groth16 "github.com/consensys/gnark/backend/groth16"
+)
+
+// default directory of the compiled circuit & keys
+var DefaultKeysDir = "keys"
+
+const (
+	CircuitFile      = "circuit.r1cs"
+	ProvingKeyFile   = "proving.key"
+	VerifyingKeyFile = "verifying.key"
+)
+
+// keys are generated for another circuit shape or version (see circuit.Hash)
+var ErrParamsMismatch = errors.New("circuit params mismatch")
+
+// write the compiled circuit, proving key and verifying key into dir
+func (ps *ProofSystem) Save(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	if err := writeFile(filepath.Join(dir, CircuitFile), ps.cfg, ps.ccs); err != nil {
+		return err
+	}
+	if err := writeFile(filepath.Join(dir, ProvingKeyFile), ps.cfg, ps.pk); err != nil {
+		return err
+	}
+	return writeFile(filepath.Join(dir, VerifyingKeyFile), ps.cfg, ps.vk)
+}
+
+// read the compiled circuit, proving key and verifying key from dir.
+// fails with ErrParamsMismatch if they were generated for another circuit shape than cfg
+func Load(dir string, cfg config.Config) (*ProofSystem, error) {
+	ccs := groth16.NewCS(ecc.BN254)
+	if err := readFile(filepath.Join(dir, CircuitFile), cfg, ccs); err != nil {
+		return nil, err
+	}
+
+	pk := groth16.NewProvingKey(ecc.BN254)
+	if err := readFile(filepath.Join(dir, ProvingKeyFile), cfg, pk); err != nil {
+		return nil, err
+	}
+
+	vk, err := LoadVerifyingKey(dir, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ProofSystem{
+		cfg: cfg,
+		ccs: ccs,
+		pk:  pk,
+		vk:  vk,
+	}, nil
+}
+
+// read only the verifying key from dir, enough to verify proofs
+func LoadVerifyingKey(dir string, cfg config.Config) (groth16.VerifyingKey, error) {
+	vk := groth16.NewVerifyingKey(ecc.BN254)
+	if err := readFile(filepath.Join(dir, VerifyingKeyFile), cfg, vk); err != nil {
+		return nil, err
+	}
+	return vk, nil
+}
+
+// load the rollup proof system from dir, or compile & setup a new one and save it into dir
+func LoadOrNew(dir string, cfg config.Config) (*ProofSystem, error) {
+	ps, err := Load(dir, cfg)
+	if err == nil {
+		slog.Info("loaded circuit & keys from " + dir)
+		return ps, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	slog.Info("no keys found in " + dir + ", running setup")
+	ps, err = NewProofSystem(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return ps, ps.Save(dir)
+}
+
+// circuit hash ∥ serialized object. The file is written to a temp file and renamed,
+// so an interrupted write leaves no partial file behind
+func writeFile(path string, cfg config.Config, obj io.WriterTo) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	defer f.Close()
+
+	if _, err := f.Write(circuit.Hash(cfg)); err != nil {
+		return err
+	}
+	if _, err := obj.WriteTo(f); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func readFile(path string, cfg config.Config, obj io.ReaderFrom) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	expected := circuit.Hash(cfg)
+	header := make([]byte, len(expected))
+	if _, err := io.ReadFull(f, header); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if !bytes.Equal(header, expected) {
+		return fmt.Errorf("%s: %w", path, ErrParamsMismatch)
+	}
+
+	if _, err := obj.ReadFrom(f); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,132 @@
+package proofSystem
+
+import (
+	"ZK-Rollup/circuit"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/backend/witness"
+)
+
+// proof of a batch with its public witness, in JSON. Byte fields are hex
+//
+//	{"batchNumber": 1, "rootBefore": "0x...", "rootAfter": "0x...", "publicWitness": "0x...", "proof": "0x..."}
+//
+// The roots & the batch number are also in the public witness, they are checked against it
+type ProofFile struct {
+	BatchNumber   uint64 `json:"batchNumber"`
+	RootBefore    string `json:"rootBefore"`
+	RootAfter     string `json:"rootAfter"`
+	PublicWitness string `json:"publicWitness"` // binary encoding of the public witness
+	Proof         string `json:"proof"`         // binary encoding of the groth16 proof
+}
+
+var ErrInvalidProofFile = errors.New("invalid proof file")
+
+func NewProofFile(p circuit.PublicInputs, proof groth16.Proof) (ProofFile, error) {
+	publicWitness, err := PublicWitness(p)
+	if err != nil {
+		return ProofFile{}, err
+	}
+	witnessBytes, err := publicWitness.MarshalBinary()
+	if err != nil {
+		return ProofFile{}, err
+	}
+	var proofBytes bytes.Buffer
+	if _, err := proof.WriteTo(&proofBytes); err != nil {
+		return ProofFile{}, err
+	}
+
+	return ProofFile{
+		BatchNumber:   p.BatchNumber,
+		RootBefore:    encodeHex(p.RootHashBefore),
+		RootAfter:     encodeHex(p.RootHashAfter),
+		PublicWitness: encodeHex(witnessBytes),
+		Proof:         encodeHex(proofBytes.Bytes()),
+	}, nil
+}
+
+// verifies the proof against the public witness with the verifying key,
+// the roots & batch number of the file should be the ones of the public witness
+func (f *ProofFile) Verify(vk groth16.VerifyingKey) error {
+	witnessBytes, err := decodeHex(f.PublicWitness)
+	if err != nil {
+		return fmt.Errorf("%w: public witness: %s", ErrInvalidProofFile, err)
+	}
+	publicWitness, err := witness.New(ecc.BN254.ScalarField())
+	if err != nil {
+		return err
+	}
+	if err := publicWitness.UnmarshalBinary(witnessBytes); err != nil {
+		return fmt.Errorf("%w: public witness: %s", ErrInvalidProofFile, err)
+	}
+
+	// roots come first and the batch number last, see circuit.Circuit
+	vector, ok := publicWitness.Vector().(fr.Vector)
+	if !ok || len(vector) < 3 {
+		return fmt.Errorf("%w: public witness", ErrInvalidProofFile)
+	}
+	var batchNumber fr.Element
+	batchNumber.SetUint64(f.BatchNumber)
+	for i, root := range []string{f.RootBefore, f.RootAfter} {
+		b, err := decodeHex(root)
+		if err != nil {
+			return fmt.Errorf("%w: root: %s", ErrInvalidProofFile, err)
+		}
+		var e fr.Element
+		e.SetBytes(b)
+		if !e.Equal(&vector[i]) {
+			return fmt.Errorf("%w: root %s is not in the public witness", ErrInvalidProofFile, root)
+		}
+	}
+	if !batchNumber.Equal(&vector[len(vector)-1]) {
+		return fmt.Errorf("%w: batch number is not in the public witness", ErrInvalidProofFile)
+	}
+
+	proofBytes, err := decodeHex(f.Proof)
+	if err != nil {
+		return fmt.Errorf("%w: proof: %s", ErrInvalidProofFile, err)
+	}
+	proof := groth16.NewProof(ecc.BN254)
+	if _, err := proof.ReadFrom(bytes.NewReader(proofBytes)); err != nil {
+		return fmt.Errorf("%w: proof: %s", ErrInvalidProofFile, err)
+	}
+
+	return VerifyProof(vk, proof, publicWitness)
+}
+
+func (f *ProofFile) Save(path string) error {
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+func LoadProofFile(path string) (ProofFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ProofFile{}, err
+	}
+	var f ProofFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return ProofFile{}, fmt.Errorf("%s: %w: %s", path, ErrInvalidProofFile, err)
+	}
+	return f, nil
+}
+
+func encodeHex(b []byte) string {
+	return "0x" + hex.EncodeToString(b)
+}
+
+func decodeHex(s string) ([]byte, error) {
+	return hex.DecodeString(strings.TrimPrefix(s, "0x"))
+}
@@ -2,55 +2,102 @@ package proofSystem
 
 import (
 	"ZK-Rollup/circuit"
+	"ZK-Rollup/config"
 	"fmt"
-	"log"
 	"time"
 
 	"github.com/consensys/gnark-crypto/ecc"
 	groth16 "github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/backend/witness"
+	"github.com/consensys/gnark/constraint"
 	"github.com/consensys/gnark/frontend"
 	"github.com/consensys/gnark/frontend/cs/r1cs"
 )
 
-func Verify(assignemnt circuit.Circuit, txNumber uint64) {
+// compiled circuit and groth16 keys, reused for every proof
+type ProofSystem struct {
+	cfg config.Config // shape of the compiled circuit
+	ccs constraint.ConstraintSystem
+	pk  groth16.ProvingKey
+	vk  groth16.VerifyingKey
+}
+
+// compiles the rollup circuit of the shape given by cfg and runs the groth16 setup
+func NewProofSystem(cfg config.Config) (*ProofSystem, error) {
+	cir := circuit.NewCircuit(cfg)
+	return New(&cir, cfg)
+}
+
+// compiles the given circuit of the shape given by cfg and runs the groth16 setup
+func New(cir frontend.Circuit, cfg config.Config) (*ProofSystem, error) {
 	start := time.Now()
-	var cir circuit.Circuit
-	//circuit := *assignemnt
-	cir.SetMerklePaths()
 
-	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &cir)
+	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, cir)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
 	pk, vk, err := groth16.Setup(ccs)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
-	witness, err := frontend.NewWitness(&assignemnt, ecc.BN254.ScalarField())
+	fmt.Println("setup time:", time.Since(start).Milliseconds(), "milliseconds")
+
+	return &ProofSystem{
+		cfg: cfg,
+		ccs: ccs,
+		pk:  pk,
+		vk:  vk,
+	}, nil
+}
+
+func (ps *ProofSystem) VerifyingKey() groth16.VerifyingKey {
+	return ps.vk
+}
+
+// generates the proof of the assignment, returns the proof and the public witness
+func (ps *ProofSystem) Prove(assignment frontend.Circuit) (groth16.Proof, witness.Witness, error) {
+	witness, err := frontend.NewWitness(assignment, ecc.BN254.ScalarField())
 	if err != nil {
-		log.Fatal(err)
+		return nil, nil, err
 	}
 	publicWitness, err := witness.Public()
 	if err != nil {
-		log.Fatal(err)
+		return nil, nil, err
 	}
 
 	startTime := time.Now()
-	proof, err := groth16.Prove(ccs, pk, witness)
+	proof, err := groth16.Prove(ps.ccs, ps.pk, witness)
 	if err != nil {
-		log.Fatal(err)
+		return nil, nil, err
 	}
-	timeInSeconds := time.Since(startTime).Milliseconds()
-	fmt.Println("prover time:", timeInSeconds, "milliseconds")
-
-	startTime = time.Now()
-	groth16.Verify(proof, vk, publicWitness)
-	timeInSeconds = time.Since(startTime).Milliseconds()
-	fmt.Println("verifier time:", timeInSeconds, "millseconds")
-	time := time.Since(start).Milliseconds()
-	fmt.Println("complete proof time (including setup):", time, "millsecods")
-	fmt.Println()
-	fmt.Println("---------------- Tx-", txNumber, "Zk Proof Verified! -------------------")
+	fmt.Println("prover time:", time.Since(startTime).Milliseconds(), "milliseconds")
+
+	return proof, publicWitness, nil
+}
+
+// verifies the proof against the public witness
+func (ps *ProofSystem) Verify(proof groth16.Proof, publicWitness witness.Witness) error {
+	return VerifyProof(ps.vk, proof, publicWitness)
+}
+
+// verifies the proof against the public witness with only the verifying key
+func VerifyProof(vk groth16.VerifyingKey, proof groth16.Proof, publicWitness witness.Witness) error {
+	startTime := time.Now()
+	err := groth16.Verify(proof, vk, publicWitness)
+	if err != nil {
+		return err
+	}
+	fmt.Println("verifier time:", time.Since(startTime).Milliseconds(), "millseconds")
+
+	return nil
+}
+
+// public witness of the rollup circuit: state roots before and after the batch,
+// and the deposits of the batch
+func PublicWitness(p circuit.PublicInputs) (witness.Witness, error) {
+	assignment := circuit.NewPublicAssignment(p)
+
+	return frontend.NewWitness(&assignment, ecc.BN254.ScalarField(), frontend.PublicOnly())
 }
@@ -0,0 +1,121 @@
+package proofSystem
+
+import (
+	"ZK-Rollup/circuit"
+	"ZK-Rollup/config"
+	"ZK-Rollup/modules/deposit"
+	"ZK-Rollup/modules/withdrawal"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/frontend"
+	"github.com/stretchr/testify/assert"
+)
+
+// x * x == y
+type squareCircuit struct {
+	X frontend.Variable
+	Y frontend.Variable `gnark:",public"`
+}
+
+func (c *squareCircuit) Define(api frontend.API) error {
+	api.AssertIsEqual(api.Mul(c.X, c.X), c.Y)
+	return nil
+}
+
+func TestProveAndVerify(t *testing.T) {
+	ps, err := New(&squareCircuit{}, config.Default())
+	assert.NoError(t, err)
+
+	// same keys are used for every proof
+	for x := 2; x < 5; x++ {
+		proof, publicWitness, err := ps.Prove(&squareCircuit{X: x, Y: x * x})
+		assert.NoError(t, err)
+		assert.NoError(t, ps.Verify(proof, publicWitness))
+	}
+
+	proof, _, err := ps.Prove(&squareCircuit{X: 3, Y: 9})
+	assert.NoError(t, err)
+
+	wrongWitness, err := frontend.NewWitness(&squareCircuit{Y: 16}, ecc.BN254.ScalarField(), frontend.PublicOnly())
+	assert.NoError(t, err)
+	assert.Error(t, ps.Verify(proof, wrongWitness))
+
+	_, _, err = ps.Prove(&squareCircuit{X: 3, Y: 10})
+	assert.Error(t, err)
+}
+
+func TestSaveAndLoad(t *testing.T) {
+	cfg := config.New(4, 1)
+	ps, err := New(&squareCircuit{}, cfg)
+	assert.NoError(t, err)
+
+	dir := t.TempDir()
+	assert.NoError(t, ps.Save(dir))
+
+	loaded, err := Load(dir, cfg)
+	assert.NoError(t, err)
+
+	// proofs of the loaded keys are verified by the saved verifying key & vice versa
+	proof, publicWitness, err := loaded.Prove(&squareCircuit{X: 3, Y: 9})
+	assert.NoError(t, err)
+	assert.NoError(t, ps.Verify(proof, publicWitness))
+
+	proof, publicWitness, err = ps.Prove(&squareCircuit{X: 4, Y: 16})
+	assert.NoError(t, err)
+	assert.NoError(t, loaded.Verify(proof, publicWitness))
+
+	// keys of another circuit shape are refused
+	cfg.BatchSize = 2
+	_, err = Load(dir, cfg)
+	assert.True(t, errors.Is(err, ErrParamsMismatch))
+
+	_, err = LoadVerifyingKey(dir, cfg)
+	assert.True(t, errors.Is(err, ErrParamsMismatch))
+
+	// and keys tagged with the config only, generated for another version of the circuit
+	cfg.BatchSize = 1
+	path := filepath.Join(dir, VerifyingKeyFile)
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(path, append(cfg.Hash(), data[len(circuit.Hash(cfg)):]...), 0o644))
+	_, err = LoadVerifyingKey(dir, cfg)
+	assert.True(t, errors.Is(err, ErrParamsMismatch))
+
+	// no temp file is left behind
+	tmp, err := filepath.Glob(filepath.Join(dir, "*.tmp"))
+	assert.NoError(t, err)
+	assert.Empty(t, tmp)
+}
+
+func TestProofFileRoots(t *testing.T) {
+	root := fr.NewElement(7)
+	rootBytes := root.Bytes()
+	f, err := NewProofFile(circuit.PublicInputs{
+		RootHashBefore: rootBytes[:],
+		RootHashAfter:  rootBytes[:],
+		Deposits:       make([]deposit.Deposit, config.Default().BatchSize),
+		Withdrawals:    make([]withdrawal.Record, config.Default().BatchSize),
+		BatchNumber:    3,
+	}, groth16.NewProof(ecc.BN254))
+	assert.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "proof.json")
+	assert.NoError(t, f.Save(path))
+	loaded, err := LoadProofFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, f, loaded)
+
+	// roots & batch number should be the ones of the public witness
+	tampered := f
+	tampered.RootAfter = "0x08"
+	assert.ErrorIs(t, tampered.Verify(nil), ErrInvalidProofFile)
+	tampered = f
+	tampered.BatchNumber = 4
+	assert.ErrorIs(t, tampered.Verify(nil), ErrInvalidProofFile)
+}
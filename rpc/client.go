@@ -0,0 +1,57 @@
+package rpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+)
+
+// client of the server at URL
+type Client struct {
+	URL  string
+	HTTP *http.Client
+
+	id atomic.Uint64
+}
+
+func NewClient(url string) *Client {
+	return &Client{URL: url, HTTP: http.DefaultClient}
+}
+
+// calls the method & decodes its result into result (if not nil).
+// The error is an *Error if the server answered with an error
+func (c *Client) Call(method string, params, result any) error {
+	req := struct {
+		Version string `json:"jsonrpc"`
+		ID      uint64 `json:"id"`
+		Method  string `json:"method"`
+		Params  any    `json:"params,omitempty"`
+	}{Version, c.id.Add(1), method, params}
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	httpRes, err := c.HTTP.Post(c.URL, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer httpRes.Body.Close()
+	if httpRes.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", c.URL, httpRes.Status)
+	}
+
+	var res Response
+	if err := json.NewDecoder(httpRes.Body).Decode(&res); err != nil {
+		return fmt.Errorf("%s: invalid response: %w", c.URL, err)
+	}
+	if res.Error != nil {
+		return res.Error
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(res.Result, result)
+}
@@ -0,0 +1,289 @@
+package rpc
+
+import (
+	"ZK-Rollup/account"
+	"ZK-Rollup/modules/transfer"
+	"ZK-Rollup/node"
+	"ZK-Rollup/proofSystem"
+	"ZK-Rollup/store"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr/mimc"
+)
+
+// params & results of the methods. Hashes, roots & proofs are hex with the 0x prefix
+
+// submitTransfer, params are the signed transfer (see transfer.Transfer)
+type SubmitTransferResult struct {
+	TxHash      string `json:"txHash"`
+	Status      string `json:"status"`
+	BatchNumber uint64 `json:"batchNumber"` // batch the transfer is executed in
+}
+
+// getAccount, by address or index
+type GetAccountParams struct {
+	Address *account.Address `json:"address,omitempty"`
+	Index   *uint64          `json:"index,omitempty"`
+}
+
+type GetNonceParams struct {
+	Address account.Address `json:"address"`
+}
+
+// the next transfer of the account has the nonce + 1
+type GetNonceResult struct {
+	Nonce uint64 `json:"nonce"`
+}
+
+// root of the state after the executed txs, the open batch included
+type GetStateRootResult struct {
+	Root        string `json:"root"`
+	BatchNumber uint64 `json:"batchNumber"` // number of sealed batches
+	TxCount     uint64 `json:"txCount"`     // number of executed txs
+}
+
+// getBatch & getProof
+type BatchParams struct {
+	Number uint64 `json:"number"`
+}
+
+type GetBatchResult struct {
+	Number          uint64   `json:"number"`
+	RootBefore      string   `json:"rootBefore"`
+	RootAfter       string   `json:"rootAfter"`
+	NbAccounts      uint64   `json:"nbAccounts"`      // number of accounts after the batch
+	UpdatedAccounts []uint64 `json:"updatedAccounts"` // indexes of the accounts updated by the batch
+	PublicWitness   string   `json:"publicWitness"`   // binary encoding of the public witness of the proof
+	Proven          bool     `json:"proven"`
+}
+
+// getProof, the result is the proof file of the batch (see proofSystem.ProofFile).
+// It's checked against the verifying key with its public witness, as rollup verify does
+
+type GetTxStatusParams struct {
+	TxHash string `json:"txHash"`
+}
+
+type GetTxStatusResult struct {
+	TxHash      string `json:"txHash"`
+	Status      string `json:"status"`
+	BatchNumber uint64 `json:"batchNumber,omitempty"` // batch of the executed transfer
+	Error       string `json:"error,omitempty"`       // reason of the rejection
+}
+
+// hash of the transfer, its signed message
+func TxHash(t transfer.Transfer) string {
+	return encodeHex(t.Message(mimc.NewMiMC()))
+}
+
+// the transfer is executed before the call returns, a transfer is submitted once
+// unless it was rejected
+func (s *Server) submitTransfer(params json.RawMessage) (any, *Error) {
+	var t transfer.Transfer
+	if err := decodeParams(params, &t); err != nil {
+		return nil, err
+	}
+	if t.TokenID >= account.NbTokens {
+		return nil, errorf(CodeInvalidParams, "invalid params: %s %d", node.ErrUnknownToken, t.TokenID)
+	}
+	if !node.IsBalance(&t.Amount) || !node.IsBalance(&t.Fee) {
+		return nil, errorf(CodeInvalidParams, "invalid params: %s", node.ErrAmountOutOfRange)
+	}
+	hash := TxHash(t)
+
+	s.mu.Lock()
+	if e, ok := s.txs[hash]; ok && e.status != StatusRejected {
+		s.mu.Unlock()
+		return nil, errorf(CodeTxRejected, "transfer %s already submitted", hash)
+	}
+	s.setTx(hash, txEntry{status: StatusPending})
+	s.mu.Unlock()
+
+	batchNumber, err := s.node.Submit(t)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.setTx(hash, txEntry{status: StatusRejected, err: err.Error()})
+		return nil, errorf(CodeTxRejected, "transfer %s rejected: %s", hash, err)
+	}
+	s.setTx(hash, txEntry{status: StatusExecuted, batchNumber: batchNumber})
+	return SubmitTransferResult{TxHash: hash, Status: StatusExecuted, BatchNumber: batchNumber}, nil
+}
+
+func (s *Server) getAccount(params json.RawMessage) (any, *Error) {
+	var p GetAccountParams
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	if (p.Address == nil) == (p.Index == nil) {
+		return nil, errorf(CodeInvalidParams, "invalid params: either address or index should be set")
+	}
+
+	var acc account.Account
+	var err error
+	s.node.View(func() {
+		if p.Address != nil {
+			acc, err = s.node.VerifyAndGetAccount(*p.Address)
+			return
+		}
+		acc, err = s.node.ReadAccount(*p.Index)
+	})
+	if err != nil {
+		return nil, accountError(err)
+	}
+	return acc, nil
+}
+
+func (s *Server) getNonce(params json.RawMessage) (any, *Error) {
+	var p GetNonceParams
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+
+	var acc account.Account
+	var err error
+	s.node.View(func() {
+		acc, err = s.node.VerifyAndGetAccount(p.Address)
+	})
+	if err != nil {
+		return nil, accountError(err)
+	}
+	return GetNonceResult{Nonce: acc.Nonce}, nil
+}
+
+func (s *Server) getStateRoot(params json.RawMessage) (any, *Error) {
+	var p struct{}
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+
+	var res GetStateRootResult
+	s.node.View(func() {
+		res = GetStateRootResult{
+			Root:        encodeHex(s.node.StateRoot()),
+			BatchNumber: s.node.BatchCount,
+			TxCount:     s.node.TxCount,
+		}
+	})
+	return res, nil
+}
+
+func (s *Server) getBatch(params json.RawMessage) (any, *Error) {
+	var p BatchParams
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	if s.store == nil {
+		return nil, errorf(CodeUnavailable, "batches aren't stored")
+	}
+
+	b, err := s.store.Batch(p.Number)
+	if err != nil {
+		return nil, storeError(err)
+	}
+	res := GetBatchResult{
+		Number:          b.Number,
+		RootBefore:      encodeHex(b.RootBefore),
+		RootAfter:       encodeHex(b.RootAfter),
+		NbAccounts:      b.NbAccounts,
+		UpdatedAccounts: make([]uint64, len(b.Updates)),
+		PublicWitness:   encodeHex(b.PublicWitness),
+		Proven:          s.store.HasProof(p.Number),
+	}
+	for i, u := range b.Updates {
+		res.UpdatedAccounts[i] = u.Index
+	}
+	return res, nil
+}
+
+func (s *Server) getProof(params json.RawMessage) (any, *Error) {
+	var p BatchParams
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	if s.store == nil {
+		return nil, errorf(CodeUnavailable, "proofs aren't stored")
+	}
+
+	b, err := s.store.Batch(p.Number)
+	if err != nil {
+		return nil, storeError(err)
+	}
+	proof, err := s.store.Proof(p.Number)
+	if err != nil {
+		return nil, storeError(err)
+	}
+	var proofBytes bytes.Buffer
+	if _, err := proof.WriteTo(&proofBytes); err != nil {
+		return nil, errorf(CodeInternalError, "internal error: %s", err)
+	}
+	return proofSystem.ProofFile{
+		BatchNumber:   b.Number,
+		RootBefore:    encodeHex(b.RootBefore),
+		RootAfter:     encodeHex(b.RootAfter),
+		PublicWitness: encodeHex(b.PublicWitness),
+		Proof:         encodeHex(proofBytes.Bytes()),
+	}, nil
+}
+
+// status of a transfer submitted to this server. An executed transfer is sealed
+// once the node sealed its batch, and proven once the proof is stored
+func (s *Server) getTxStatus(params json.RawMessage) (any, *Error) {
+	var p GetTxStatusParams
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	hash, err := decodeHex(p.TxHash)
+	if err != nil || len(hash) != mimc.BlockSize {
+		return nil, errorf(CodeInvalidParams, "invalid params: tx hash %q", p.TxHash)
+	}
+	txHash := encodeHex(hash)
+
+	s.mu.Lock()
+	e, ok := s.txs[txHash]
+	s.mu.Unlock()
+	if !ok {
+		return nil, errorf(CodeNotFound, "transfer %s not found", txHash)
+	}
+
+	if e.status == StatusExecuted {
+		var sealed uint64
+		s.node.View(func() {
+			sealed = s.node.BatchCount
+		})
+		if e.batchNumber <= sealed {
+			e.status = StatusSealed
+			if s.store != nil && s.store.HasProof(e.batchNumber) {
+				e.status = StatusProven
+			}
+		}
+	}
+	return GetTxStatusResult{TxHash: txHash, Status: e.status, BatchNumber: e.batchNumber, Error: e.err}, nil
+}
+
+func accountError(err error) *Error {
+	if errors.Is(err, node.ErrUnknownAccount) {
+		return errorf(CodeNotFound, "%s", err)
+	}
+	return errorf(CodeInternalError, "internal error: %s", err)
+}
+
+func storeError(err error) *Error {
+	if errors.Is(err, store.ErrNotFound) {
+		return errorf(CodeNotFound, "%s", err)
+	}
+	return errorf(CodeInternalError, "internal error: %s", err)
+}
+
+func encodeHex(b []byte) string {
+	return "0x" + hex.EncodeToString(b)
+}
+
+func decodeHex(s string) ([]byte, error) {
+	return hex.DecodeString(strings.TrimPrefix(s, "0x"))
+}
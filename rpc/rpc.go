@@ -0,0 +1,119 @@
+package rpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// JSON-RPC 2.0 over HTTP POST, a request per call (no batches, no notifications)
+//
+//	{"jsonrpc": "2.0", "id": 1, "method": "getAccount", "params": {"address": "0x..."}}
+const Version = "2.0"
+
+// max size of a request body
+const MaxRequestSize = 1 << 20
+
+type Request struct {
+	Version string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type Response struct {
+	Version string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// error codes, the JSON-RPC ones & the ones of the node
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+
+	CodeTxRejected  = -32000 // the node rejected the tx
+	CodeNotFound    = -32001 // unknown account, batch, proof or tx
+	CodeUnavailable = -32002 // the node has no store, batches & proofs aren't kept
+)
+
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("rpc error %d: %s", e.Code, e.Message)
+}
+
+func errorf(code int, format string, args ...any) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// params of the method, fields are decoded strictly. Methods without params
+// accept no params, null or {}
+func decodeParams(params json.RawMessage, v any) *Error {
+	if len(params) == 0 || bytes.Equal(params, []byte("null")) {
+		params = []byte("{}")
+	}
+	d := json.NewDecoder(bytes.NewReader(params))
+	d.DisallowUnknownFields()
+	if err := d.Decode(v); err != nil {
+		return errorf(CodeInvalidParams, "invalid params: %s", err)
+	}
+	if d.More() {
+		return errorf(CodeInvalidParams, "invalid params: trailing data")
+	}
+	return nil
+}
+
+// reads the request of the body, the error is the response to send if the request is invalid
+func readRequest(w http.ResponseWriter, r *http.Request) (Request, *Error) {
+	var req Request
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MaxRequestSize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return req, errorf(CodeInvalidRequest, "request larger than %d bytes", MaxRequestSize)
+		}
+		return req, errorf(CodeParseError, "parse error: %s", err)
+	}
+
+	if trimmed := bytes.TrimSpace(data); len(trimmed) != 0 && trimmed[0] == '[' {
+		return req, errorf(CodeInvalidRequest, "batch requests aren't supported")
+	}
+	if err := json.Unmarshal(data, &req); err != nil {
+		return req, errorf(CodeParseError, "parse error: %s", err)
+	}
+	if req.Version != Version {
+		return req, errorf(CodeInvalidRequest, "jsonrpc should be %q", Version)
+	}
+	if len(req.ID) == 0 || bytes.Equal(req.ID, []byte("null")) {
+		return req, errorf(CodeInvalidRequest, "missing id, notifications aren't supported")
+	}
+	switch req.ID[0] {
+	case '"', '-', '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+	default:
+		return req, errorf(CodeInvalidRequest, "id should be a string or a number")
+	}
+	if req.Method == "" {
+		return req, errorf(CodeInvalidRequest, "missing method")
+	}
+	return req, nil
+}
+
+func writeResponse(w http.ResponseWriter, res Response) {
+	if res.ID == nil {
+		res.ID = json.RawMessage("null")
+	}
+	res.Version = Version
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
@@ -0,0 +1,122 @@
+package rpc
+
+import (
+	"ZK-Rollup/node"
+	"ZK-Rollup/store"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// status of a submitted transfer
+const (
+	StatusPending  = "pending"  // waiting to be executed
+	StatusRejected = "rejected" // rejected by the node
+	StatusExecuted = "executed" // executed in the open batch
+	StatusSealed   = "sealed"   // its batch is sealed, waiting for the proof
+	StatusProven   = "proven"   // the proof of its batch is in the store
+)
+
+// number of submitted transfers whose status is kept, the oldest ones are dropped first
+var MaxTxStatuses = 100000
+
+// JSON-RPC server of a running node, the state is read in the node loop (see node.View).
+// Batches & proofs are read from the store, if not nil
+type Server struct {
+	node  *node.Node
+	store *store.Store
+
+	mu    sync.Mutex
+	txs   map[string]txEntry // submitted transfers by hash, kept in memory only
+	order []string           // hashes of txs, oldest first
+}
+
+type txEntry struct {
+	status      string
+	batchNumber uint64
+	err         string
+}
+
+// sets the status of the transfer, s.mu should be held. The oldest statuses are dropped
+// past MaxTxStatuses
+func (s *Server) setTx(hash string, e txEntry) {
+	if _, ok := s.txs[hash]; !ok {
+		s.order = append(s.order, hash)
+	}
+	s.txs[hash] = e
+	for len(s.order) > MaxTxStatuses {
+		delete(s.txs, s.order[0])
+		s.order = s.order[1:]
+	}
+}
+
+// method of the server, params are decoded by the method
+type method func(s *Server, params json.RawMessage) (any, *Error)
+
+var methods = map[string]method{
+	"submitTransfer": (*Server).submitTransfer,
+	"getAccount":     (*Server).getAccount,
+	"getNonce":       (*Server).getNonce,
+	"getStateRoot":   (*Server).getStateRoot,
+	"getBatch":       (*Server).getBatch,
+	"getProof":       (*Server).getProof,
+	"getTxStatus":    (*Server).getTxStatus,
+}
+
+// server of the node, the node should be listening (see node.ListenForTransfers)
+func NewServer(n *node.Node, st *store.Store) *Server {
+	return &Server{
+		node:  n,
+		store: st,
+		txs:   make(map[string]txEntry),
+	}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "only POST is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	req, rpcErr := readRequest(w, r)
+	if rpcErr != nil {
+		writeResponse(w, Response{ID: req.ID, Error: rpcErr})
+		return
+	}
+	res := Response{ID: req.ID}
+
+	m, ok := methods[req.Method]
+	if !ok {
+		res.Error = errorf(CodeMethodNotFound, "method %q not found", req.Method)
+		writeResponse(w, res)
+		return
+	}
+	result, rpcErr := m(s, req.Params)
+	if rpcErr != nil {
+		res.Error = rpcErr
+		writeResponse(w, res)
+		return
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		res.Error = errorf(CodeInternalError, "internal error: %s", err)
+	}
+	res.Result = data
+	writeResponse(w, res)
+}
+
+// blocking call, serves the node on addr
+func (s *Server) ListenAndServe(addr string) error {
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           s,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	slog.Info(fmt.Sprintf("rpc server listening on %s", addr))
+	return srv.ListenAndServe()
+}
@@ -0,0 +1,195 @@
+package rpc
+
+import (
+	"ZK-Rollup/account"
+	"ZK-Rollup/config"
+	"ZK-Rollup/modules/transfer"
+	"ZK-Rollup/node"
+	"ZK-Rollup/proofSystem"
+	"ZK-Rollup/snapshot"
+	"ZK-Rollup/store"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr/mimc"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/backend/witness"
+	"github.com/stretchr/testify/assert"
+)
+
+// cfg seals a batch per tx
+var testConfig = config.New(8, 1)
+
+// server of a running node with 4 accounts, sealed batches get an empty proof
+func newTestServer(t *testing.T) (*Client, map[uint64]node.SignatureAccount) {
+	accounts, data := node.NewRandomAccounts(4)
+	base, err := snapshot.New(testConfig, 0, data)
+	assert.NoError(t, err)
+	st, err := store.Open(t.TempDir(), testConfig)
+	assert.NoError(t, err)
+	t.Cleanup(func() { st.Close() })
+	n, err := node.OpenNode(testConfig, st, base)
+	assert.NoError(t, err)
+
+	go n.ListenForTransfers()
+	go func() {
+		for job := range n.Jobs() {
+			st.PutProof(job.BatchNumber, groth16.NewProof(ecc.BN254))
+		}
+	}()
+
+	srv := httptest.NewServer(NewServer(&n, st))
+	t.Cleanup(srv.Close)
+	return NewClient(srv.URL), accounts
+}
+
+func signedTransfer(t *testing.T, from, to node.SignatureAccount, nonce uint64) transfer.Transfer {
+	tx := transfer.NewTransfer(12, 1, from.PubKey, to.PubKey, nonce)
+	assert.NoError(t, tx.SetSign(mimc.NewMiMC(), from.PrivKey))
+	return tx
+}
+
+func assertCode(t *testing.T, err error, code int) {
+	rpcErr, ok := err.(*Error)
+	if assert.True(t, ok, err) {
+		assert.Equal(t, code, rpcErr.Code, rpcErr.Message)
+	}
+}
+
+func TestServer(t *testing.T) {
+	client, accounts := newTestServer(t)
+	sender := account.AddressOf(accounts[1].PubKey)
+
+	var nonce GetNonceResult
+	assert.NoError(t, client.Call("getNonce", GetNonceParams{Address: sender}, &nonce))
+	assert.Equal(t, uint64(0), nonce.Nonce)
+
+	var root GetStateRootResult
+	assert.NoError(t, client.Call("getStateRoot", nil, &root))
+	assert.Equal(t, uint64(0), root.BatchNumber)
+
+	tx := signedTransfer(t, accounts[1], accounts[2], 1)
+	var submitted SubmitTransferResult
+	assert.NoError(t, client.Call("submitTransfer", tx, &submitted))
+	assert.Equal(t, TxHash(tx), submitted.TxHash)
+	assert.Equal(t, StatusExecuted, submitted.Status)
+	assert.Equal(t, uint64(1), submitted.BatchNumber)
+
+	// submitted once, and the nonce is checked by the node
+	assertCode(t, client.Call("submitTransfer", tx, nil), CodeTxRejected)
+	rejected := signedTransfer(t, accounts[1], accounts[2], 5)
+	err := client.Call("submitTransfer", rejected, nil)
+	assertCode(t, err, CodeTxRejected)
+	assert.Contains(t, err.Error(), node.ErrBadNonce.Error())
+
+	var status GetTxStatusResult
+	assert.NoError(t, client.Call("getTxStatus", GetTxStatusParams{TxHash: TxHash(rejected)}, &status))
+	assert.Equal(t, StatusRejected, status.Status)
+	assert.Contains(t, status.Error, node.ErrBadNonce.Error())
+	assert.Eventually(t, func() bool {
+		assert.NoError(t, client.Call("getTxStatus", GetTxStatusParams{TxHash: submitted.TxHash}, &status))
+		return status.Status == StatusProven
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, uint64(1), status.BatchNumber)
+
+	var acc account.Account
+	assert.NoError(t, client.Call("getAccount", GetAccountParams{Address: &sender}, &acc))
+	assert.Equal(t, uint64(1), acc.Index)
+	assert.Equal(t, uint64(1), acc.Nonce)
+	index := uint64(2)
+	assert.NoError(t, client.Call("getAccount", GetAccountParams{Index: &index}, &acc))
+	assert.Equal(t, account.AddressOf(accounts[2].PubKey), acc.Address())
+
+	var batch GetBatchResult
+	assert.NoError(t, client.Call("getBatch", BatchParams{Number: 1}, &batch))
+	assert.Equal(t, root.Root, batch.RootBefore)
+	assert.True(t, batch.Proven)
+	assert.Contains(t, batch.UpdatedAccounts, uint64(1))
+	assert.Contains(t, batch.UpdatedAccounts, uint64(2))
+
+	assert.NoError(t, client.Call("getStateRoot", nil, &root))
+	assert.Equal(t, uint64(1), root.BatchNumber)
+	assert.Equal(t, batch.RootAfter, root.Root)
+
+	var proof proofSystem.ProofFile
+	assert.NoError(t, client.Call("getProof", BatchParams{Number: 1}, &proof))
+	assert.Equal(t, batch.RootAfter, proof.RootAfter)
+	assert.Equal(t, batch.PublicWitness, proof.PublicWitness)
+
+	// roots first, the batch number last
+	witnessBytes, err := decodeHex(proof.PublicWitness)
+	assert.NoError(t, err)
+	publicWitness, err := witness.New(ecc.BN254.ScalarField())
+	assert.NoError(t, err)
+	assert.NoError(t, publicWitness.UnmarshalBinary(witnessBytes))
+	vector := publicWitness.Vector().(fr.Vector)
+	rootBefore := vector[0].Bytes()
+	assert.Equal(t, proof.RootBefore, encodeHex(rootBefore[:]))
+	assert.True(t, vector[len(vector)-1].IsOne())
+
+	assertCode(t, client.Call("getProof", BatchParams{Number: 2}, nil), CodeNotFound)
+	index = 7
+	assertCode(t, client.Call("getAccount", GetAccountParams{Index: &index}, nil), CodeNotFound)
+	assertCode(t, client.Call("getTxStatus", GetTxStatusParams{TxHash: TxHash(signedTransfer(t, accounts[2], accounts[1], 1))}, nil), CodeNotFound)
+}
+
+func TestInvalidRequests(t *testing.T) {
+	client, accounts := newTestServer(t)
+
+	assertCode(t, client.Call("getBalance", nil, nil), CodeMethodNotFound)
+	assertCode(t, client.Call("getAccount", map[string]any{}, nil), CodeInvalidParams)
+	assertCode(t, client.Call("getNonce", map[string]any{"address": "0x1234"}, nil), CodeInvalidParams)
+	assertCode(t, client.Call("getBatch", map[string]any{"number": 1, "proof": true}, nil), CodeInvalidParams)
+	assertCode(t, client.Call("getTxStatus", GetTxStatusParams{TxHash: "0x12"}, nil), CodeInvalidParams)
+
+	tx := signedTransfer(t, accounts[1], accounts[2], 1)
+	tx.TokenID = account.NbTokens
+	assertCode(t, client.Call("submitTransfer", tx, nil), CodeInvalidParams)
+
+	post := func(body string) Response {
+		httpRes, err := http.Post(client.URL, "application/json", strings.NewReader(body))
+		assert.NoError(t, err)
+		defer httpRes.Body.Close()
+		var res Response
+		assert.NoError(t, json.NewDecoder(httpRes.Body).Decode(&res))
+		return res
+	}
+	for body, code := range map[string]int{
+		`{"jsonrpc": "2.0", "id": 1`:                                          CodeParseError,
+		`{"jsonrpc": "1.0", "id": 1, "method": "getStateRoot"}`:               CodeInvalidRequest,
+		`{"jsonrpc": "2.0", "method": "getStateRoot"}`:                        CodeInvalidRequest,
+		`[{"jsonrpc": "2.0", "id": 1, "method": "getStateRoot"}]`:             CodeInvalidRequest,
+		`{"jsonrpc": "2.0", "id": 1, "method": "getStateRoot", "params": []}`: CodeInvalidParams,
+	} {
+		res := post(body)
+		if assert.NotNil(t, res.Error, body) {
+			assert.Equal(t, code, res.Error.Code, body)
+		}
+	}
+
+	httpRes, err := http.Get(client.URL)
+	assert.NoError(t, err)
+	httpRes.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, httpRes.StatusCode)
+}
+
+func TestTxStatusLimit(t *testing.T) {
+	limit := MaxTxStatuses
+	MaxTxStatuses = 2
+	defer func() { MaxTxStatuses = limit }()
+
+	s := NewServer(nil, nil)
+	for _, hash := range []string{"a", "b", "a", "c"} {
+		s.setTx(hash, txEntry{status: StatusPending})
+	}
+	assert.Len(t, s.txs, 2)
+	assert.NotContains(t, s.txs, "a")
+	assert.Contains(t, s.txs, "b")
+	assert.Contains(t, s.txs, "c")
+}
@@ -8,15 +8,16 @@ import (
 	"github.com/consensys/gnark-crypto/ecc/bn254/twistededwards/eddsa"
 )
 
-func Sign(msg []byte, privateKey eddsa.PrivateKey, hFunc hash.Hash) eddsa.Signature {
+func Sign(msg []byte, privateKey eddsa.PrivateKey, hFunc hash.Hash) (eddsa.Signature, error) {
+	var signature eddsa.Signature
+
 	signBytes, err := privateKey.Sign(msg, hFunc)
 	if err != nil {
-		log.Fatal(err)
+		return signature, err
 	}
 
-	var signature eddsa.Signature
-	signature.SetBytes(signBytes)
-	return signature
+	_, err = signature.SetBytes(signBytes)
+	return signature, err
 }
 
 func Verify(msg []byte, pubKey eddsa.PublicKey, signature []byte, hFunc hash.Hash) (bool, error) {
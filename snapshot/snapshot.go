@@ -0,0 +1,201 @@
+package snapshot
+
+import (
+	"ZK-Rollup/account"
+	"ZK-Rollup/config"
+	"ZK-Rollup/stateTree"
+	"ZK-Rollup/store"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr/mimc"
+)
+
+// Full state of the rollup after a committed batch, a node is bootstrapped from it
+// without replaying the batches before it
+//
+//	magic ∥ version ∥ config hash ∥ batch number ∥ account codec version ∥ root ∥ nbAccounts ∥ accounts ∥ sha256 of all the previous bytes
+//
+// The root is checked against the accounts when the snapshot is read, a snapshot is only valid for the rollup shape it was exported from.
+type Snapshot struct {
+	BatchNumber uint64
+	Root        []byte
+	Accounts    []byte // account bytes appended, in the current account encoding
+}
+
+const Version uint8 = 1
+
+var magic = []byte("ZKRS")
+
+var (
+	ErrInvalidSnapshot = errors.New("invalid snapshot")
+	ErrChecksum        = errors.New("snapshot checksum mismatch")
+	ErrRootMismatch    = errors.New("snapshot root mismatch")
+	ErrParamsMismatch  = errors.New("snapshot params mismatch")
+)
+
+// snapshot of the accounts after the batch, the root is computed from the accounts
+func New(cfg config.Config, batchNumber uint64, accounts []byte) (Snapshot, error) {
+	root, err := Root(cfg, accounts)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	return Snapshot{
+		BatchNumber: batchNumber,
+		Root:        root,
+		Accounts:    accounts,
+	}, nil
+}
+
+// state root of the accounts
+func Root(cfg config.Config, accounts []byte) ([]byte, error) {
+	if len(accounts)%account.AccountSizeInBytes != 0 || len(accounts) > cfg.NbAccounts*account.AccountSizeInBytes {
+		return nil, fmt.Errorf("%w: accounts length %d", ErrInvalidSnapshot, len(accounts))
+	}
+
+	hFunc := mimc.NewMiMC()
+	tree := stateTree.New(mimc.NewMiMC(), cfg.TreeDepth())
+	for i := 0; i*account.AccountSizeInBytes < len(accounts); i++ {
+		hFunc.Reset()
+		hFunc.Write(accounts[i*account.AccountSizeInBytes : (i+1)*account.AccountSizeInBytes])
+		if err := tree.Set(uint64(i), hFunc.Sum(nil)); err != nil {
+			return nil, err
+		}
+	}
+	return tree.Root(), nil
+}
+
+// number of accounts of the snapshot
+func (s *Snapshot) NbAccounts() int {
+	return len(s.Accounts) / account.AccountSizeInBytes
+}
+
+// the recorded root should be the root of the accounts
+func (s *Snapshot) Verify(cfg config.Config) error {
+	root, err := Root(cfg, s.Accounts)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(root, s.Root) {
+		return ErrRootMismatch
+	}
+	return nil
+}
+
+func (s *Snapshot) Encode(cfg config.Config) []byte {
+	var buf bytes.Buffer
+	buf.Write(magic)
+	buf.WriteByte(Version)
+	buf.Write(cfg.Hash())
+	buf.Write(binary.BigEndian.AppendUint64(nil, s.BatchNumber))
+	buf.WriteByte(uint8(account.Current.Version))
+	buf.Write(binary.BigEndian.AppendUint64(nil, uint64(len(s.Root))))
+	buf.Write(s.Root)
+	buf.Write(binary.BigEndian.AppendUint64(nil, uint64(s.NbAccounts())))
+	buf.Write(s.Accounts)
+
+	checksum := sha256.Sum256(buf.Bytes())
+	buf.Write(checksum[:])
+	return buf.Bytes()
+}
+
+// strict decoding of the snapshot, checked against the checksum and the recorded root
+func Decode(cfg config.Config, data []byte) (Snapshot, error) {
+	if len(data) < sha256.Size {
+		return Snapshot{}, ErrInvalidSnapshot
+	}
+	body, checksum := data[:len(data)-sha256.Size], data[len(data)-sha256.Size:]
+	if expected := sha256.Sum256(body); !bytes.Equal(expected[:], checksum) {
+		return Snapshot{}, ErrChecksum
+	}
+
+	r := bytes.NewReader(body)
+	header := make([]byte, len(magic)+1)
+	if _, err := io.ReadFull(r, header); err != nil || !bytes.Equal(header[:len(magic)], magic) {
+		return Snapshot{}, fmt.Errorf("%w: not a snapshot", ErrInvalidSnapshot)
+	}
+	if header[len(magic)] != Version {
+		return Snapshot{}, fmt.Errorf("%w: version %d", ErrInvalidSnapshot, header[len(magic)])
+	}
+	cfgHash := make([]byte, len(cfg.Hash()))
+	if _, err := io.ReadFull(r, cfgHash); err != nil || !bytes.Equal(cfgHash, cfg.Hash()) {
+		return Snapshot{}, ErrParamsMismatch
+	}
+
+	var s Snapshot
+	var fields struct {
+		BatchNumber  uint64
+		CodecVersion uint8
+		RootLength   uint64
+	}
+	if err := binary.Read(r, binary.BigEndian, &fields); err != nil {
+		return Snapshot{}, fmt.Errorf("%w: %s", ErrInvalidSnapshot, err)
+	}
+	if account.Version(fields.CodecVersion) != account.Current.Version {
+		return Snapshot{}, fmt.Errorf("%w: accounts encoded with version %d, migrate them to version %d", ErrInvalidSnapshot, fields.CodecVersion, account.Current.Version)
+	}
+	if fields.RootLength != uint64(mimc.NewMiMC().Size()) {
+		return Snapshot{}, fmt.Errorf("%w: root length %d", ErrInvalidSnapshot, fields.RootLength)
+	}
+	s.BatchNumber = fields.BatchNumber
+	s.Root = make([]byte, fields.RootLength)
+	if _, err := io.ReadFull(r, s.Root); err != nil {
+		return Snapshot{}, fmt.Errorf("%w: %s", ErrInvalidSnapshot, err)
+	}
+
+	var nbAccounts uint64
+	if err := binary.Read(r, binary.BigEndian, &nbAccounts); err != nil {
+		return Snapshot{}, fmt.Errorf("%w: %s", ErrInvalidSnapshot, err)
+	}
+	if nbAccounts > uint64(cfg.NbAccounts) || uint64(r.Len()) != nbAccounts*uint64(account.AccountSizeInBytes) {
+		return Snapshot{}, fmt.Errorf("%w: %d accounts", ErrInvalidSnapshot, nbAccounts)
+	}
+	s.Accounts = make([]byte, r.Len())
+	if _, err := io.ReadFull(r, s.Accounts); err != nil {
+		return Snapshot{}, fmt.Errorf("%w: %s", ErrInvalidSnapshot, err)
+	}
+
+	if err := s.Verify(cfg); err != nil {
+		return Snapshot{}, err
+	}
+	return s, nil
+}
+
+// write the snapshot to a temp file renamed to path
+func (s *Snapshot) Save(path string, cfg config.Config) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, s.Encode(cfg), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func Load(path string, cfg config.Config) (Snapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	s, err := Decode(cfg, data)
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+// snapshot of the state after the committed batch of the store
+func FromStore(st *store.Store, batchNumber uint64) (Snapshot, error) {
+	state, err := st.StateAt(batchNumber)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	return Snapshot{
+		BatchNumber: state.BatchNumber,
+		Root:        state.Root(),
+		Accounts:    state.Accounts,
+	}, nil
+}
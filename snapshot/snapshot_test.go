@@ -0,0 +1,49 @@
+package snapshot
+
+import (
+	"ZK-Rollup/account"
+	"ZK-Rollup/config"
+	"crypto/sha256"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testConfig = config.Default()
+
+func accounts(nbAccounts uint64) []byte {
+	var res []byte
+	for i := uint64(0); i < nbAccounts; i++ {
+		acc := account.Account{Index: i, Nonce: i}
+		res = append(res, acc.Marshal()...)
+	}
+	return res
+}
+
+func TestEncoding(t *testing.T) {
+	s, err := New(testConfig, 7, accounts(3))
+	assert.NoError(t, err)
+	assert.NoError(t, s.Verify(testConfig))
+
+	path := filepath.Join(t.TempDir(), "state.snapshot")
+	assert.NoError(t, s.Save(path, testConfig))
+	loaded, err := Load(path, testConfig)
+	assert.NoError(t, err)
+	assert.Equal(t, s, loaded)
+
+	// corrupted bytes
+	data := s.Encode(testConfig)
+	data[len(data)-sha256.Size-1] ^= 1
+	_, err = Decode(testConfig, data)
+	assert.ErrorIs(t, err, ErrChecksum)
+
+	// consistent checksum, but the root isn't the root of the accounts
+	tampered := s
+	tampered.Accounts = accounts(2)
+	_, err = Decode(testConfig, tampered.Encode(testConfig))
+	assert.ErrorIs(t, err, ErrRootMismatch)
+
+	_, err = Decode(config.New(32, 4), s.Encode(testConfig))
+	assert.ErrorIs(t, err, ErrParamsMismatch)
+}
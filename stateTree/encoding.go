@@ -0,0 +1,148 @@
+package stateTree
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+var ErrInvalidEncoding = errors.New("invalid tree encoding")
+
+// stored leaves & nodes, only the non empty ones, in index order
+//
+//	depth ∥ nbLeaves ∥ (index ∥ leaf data)* ∥ for every level: nbNodes ∥ (index ∥ node)*
+func (t *Tree) WriteTo(w io.Writer) (int64, error) {
+	var n int64
+	write := func(b []byte) error {
+		m, err := w.Write(b)
+		n += int64(m)
+		return err
+	}
+	writeUint64 := func(v uint64) error {
+		return write(binary.BigEndian.AppendUint64(nil, v))
+	}
+	writeMap := func(m map[uint64][]byte) error {
+		if err := writeUint64(uint64(len(m))); err != nil {
+			return err
+		}
+		for _, index := range sortedKeys(m) {
+			if err := writeUint64(index); err != nil {
+				return err
+			}
+			if err := write(m[index]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := writeUint64(uint64(t.depth)); err != nil {
+		return n, err
+	}
+	if err := writeMap(t.leaves); err != nil {
+		return n, err
+	}
+	for _, nodes := range t.nodes {
+		if err := writeMap(nodes); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// read the leaves & nodes written by WriteTo, the tree should be empty & have the same depth.
+// The nodes are checked against the leaves, so the root is the one of the leaves
+func (t *Tree) ReadFrom(r io.Reader) (int64, error) {
+	var n int64
+	read := func(b []byte) error {
+		m, err := io.ReadFull(r, b)
+		n += int64(m)
+		return err
+	}
+	readUint64 := func() (uint64, error) {
+		var b [8]byte
+		err := read(b[:])
+		return binary.BigEndian.Uint64(b[:]), err
+	}
+	readMap := func(m map[uint64][]byte, level int) error {
+		count, err := readUint64()
+		if err != nil {
+			return err
+		}
+		if count > t.NbLeaves()>>level {
+			return fmt.Errorf("%w: %d nodes at level %d", ErrInvalidEncoding, count, level)
+		}
+		for i := uint64(0); i < count; i++ {
+			index, err := readUint64()
+			if err != nil {
+				return err
+			}
+			if index >= t.NbLeaves()>>level {
+				return fmt.Errorf("%w: node index %d at level %d", ErrInvalidEncoding, index, level)
+			}
+			node := make([]byte, t.hFunc.Size())
+			if err := read(node); err != nil {
+				return err
+			}
+			m[index] = node
+		}
+		return nil
+	}
+
+	depth, err := readUint64()
+	if err != nil {
+		return n, err
+	}
+	if depth != uint64(t.depth) {
+		return n, fmt.Errorf("%w: depth %d, expected %d", ErrInvalidEncoding, depth, t.depth)
+	}
+	if err := readMap(t.leaves, 0); err != nil {
+		return n, err
+	}
+	for level := range t.nodes {
+		if err := readMap(t.nodes[level], level); err != nil {
+			return n, err
+		}
+	}
+	return n, t.check()
+}
+
+// every node above a non empty subtree is the hash of its children, from the leaves to the root
+func (t *Tree) check() error {
+	indexes := make(map[uint64]bool)
+	for index := range t.leaves {
+		indexes[index] = true
+	}
+	for level := 0; level <= t.depth; level++ {
+		for index := range t.nodes[level] {
+			indexes[index] = true
+		}
+		parents := make(map[uint64]bool)
+		for index := range indexes {
+			var expected []byte
+			if level == 0 {
+				expected = t.sum(t.Leaf(index))
+			} else {
+				expected = t.sum(t.node(level-1, 2*index), t.node(level-1, 2*index+1))
+			}
+			if !bytes.Equal(t.node(level, index), expected) {
+				return fmt.Errorf("%w: node %d at level %d", ErrInvalidEncoding, index, level)
+			}
+			parents[index>>1] = true
+		}
+		indexes = parents
+	}
+	return nil
+}
+
+func sortedKeys(m map[uint64][]byte) []uint64 {
+	keys := make([]uint64, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
@@ -0,0 +1,131 @@
+package stateTree
+
+import (
+	"bytes"
+	"fmt"
+	"hash"
+)
+
+// Sparse merkle tree of fixed depth, updated incrementally: setting a leaf only
+// rehashes the depth nodes above it, and proofs are read from the cached nodes.
+//
+// Hashes are the same as gnark-crypto's merkletree, so proofs can be verified by
+// merkletree.VerifyProof and by gnark's merkle.MerkleProof in the circuit
+//
+//	leaf node = H(leaf data), node = H(left ∥ right)
+//
+// Empty leaves have zero leaf data.
+type Tree struct {
+	hFunc  hash.Hash
+	depth  int                 // number of levels above the leaves
+	leaves map[uint64][]byte   // leaf data by index, only non empty leaves
+	nodes  []map[uint64][]byte // nodes[0] are the leaf nodes, nodes[depth] is the root
+	empty  [][]byte            // empty[i] is the node of an empty subtree at level i
+}
+
+func New(hFunc hash.Hash, depth int) *Tree {
+	t := &Tree{
+		hFunc:  hFunc,
+		depth:  depth,
+		leaves: make(map[uint64][]byte),
+		nodes:  make([]map[uint64][]byte, depth+1),
+		empty:  make([][]byte, depth+1),
+	}
+
+	t.empty[0] = t.sum(make([]byte, hFunc.Size()))
+	for i := 0; i < depth; i++ {
+		t.empty[i+1] = t.sum(t.empty[i], t.empty[i])
+	}
+	for i := range t.nodes {
+		t.nodes[i] = make(map[uint64][]byte)
+	}
+
+	return t
+}
+
+func (t *Tree) Depth() int {
+	return t.depth
+}
+
+// max number of leaves
+func (t *Tree) NbLeaves() uint64 {
+	return 1 << t.depth
+}
+
+// set the data of the leaf at index & update the nodes above it
+func (t *Tree) Set(index uint64, data []byte) error {
+	if index >= t.NbLeaves() {
+		return fmt.Errorf("leaf index %d out of range, tree has %d leaves", index, t.NbLeaves())
+	}
+	if len(data) != t.hFunc.Size() {
+		return fmt.Errorf("invalid leaf data: required %d bytes, but found %d bytes", t.hFunc.Size(), len(data))
+	}
+
+	leaf := make([]byte, len(data))
+	copy(leaf, data)
+	if bytes.Equal(leaf, make([]byte, len(data))) {
+		delete(t.leaves, index)
+	} else {
+		t.leaves[index] = leaf
+	}
+
+	t.setNode(0, index, t.sum(leaf))
+	for level := 0; level < t.depth; level++ {
+		index >>= 1
+		t.setNode(level+1, index, t.sum(t.node(level, 2*index), t.node(level, 2*index+1)))
+	}
+
+	return nil
+}
+
+// data of the leaf at index
+func (t *Tree) Leaf(index uint64) []byte {
+	if leaf, ok := t.leaves[index]; ok {
+		return leaf
+	}
+	return make([]byte, t.hFunc.Size())
+}
+
+func (t *Tree) Root() []byte {
+	return t.node(t.depth, 0)
+}
+
+// proof of the leaf at index: leaf data ∥ siblings from the leaf to the root
+func (t *Tree) Prove(index uint64) ([][]byte, error) {
+	if index >= t.NbLeaves() {
+		return nil, fmt.Errorf("leaf index %d out of range, tree has %d leaves", index, t.NbLeaves())
+	}
+
+	proof := make([][]byte, 0, t.depth+1)
+	proof = append(proof, t.Leaf(index))
+	for level := 0; level < t.depth; level++ {
+		proof = append(proof, t.node(level, index^1))
+		index >>= 1
+	}
+
+	return proof, nil
+}
+
+func (t *Tree) node(level int, index uint64) []byte {
+	if node, ok := t.nodes[level][index]; ok {
+		return node
+	}
+	return t.empty[level]
+}
+
+// only nodes of non empty subtrees are stored
+func (t *Tree) setNode(level int, index uint64, node []byte) {
+	if bytes.Equal(node, t.empty[level]) {
+		delete(t.nodes[level], index)
+		return
+	}
+	t.nodes[level][index] = node
+}
+
+func (t *Tree) sum(data ...[]byte) []byte {
+	t.hFunc.Reset()
+	for _, d := range data {
+		t.hFunc.Write(d)
+	}
+	return t.hFunc.Sum(nil)
+}
@@ -0,0 +1,106 @@
+package stateTree
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/accumulator/merkletree"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr/mimc"
+	"github.com/stretchr/testify/assert"
+)
+
+func leafData(i uint64) []byte {
+	e := fr.NewElement(i*7 + 1)
+	b := e.Bytes()
+	return b[:]
+}
+
+// same roots & proofs as merkletree built from all the leaves
+func TestTreeMatchesMerkleTree(t *testing.T) {
+	hFunc := mimc.NewMiMC()
+	tree := New(mimc.NewMiMC(), 4)
+
+	// half of the leaves are empty
+	data := make([]byte, 16*hFunc.Size())
+	for i := uint64(0); i < 16; i += 2 {
+		assert.NoError(t, tree.Set(i, leafData(i)))
+		copy(data[i*uint64(hFunc.Size()):], leafData(i))
+	}
+
+	for i := uint64(0); i < 16; i++ {
+		root, expected, numLeaves, err := merkletree.BuildReaderProof(bytes.NewBuffer(data), hFunc, hFunc.Size(), i)
+		assert.NoError(t, err)
+		assert.Equal(t, root, tree.Root())
+
+		proof, err := tree.Prove(i)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, proof)
+		assert.True(t, merkletree.VerifyProof(hFunc, tree.Root(), proof, i, numLeaves))
+	}
+
+	// clearing the leaves gives the empty tree
+	for i := uint64(0); i < 16; i += 2 {
+		assert.NoError(t, tree.Set(i, make([]byte, hFunc.Size())))
+	}
+	assert.Equal(t, New(mimc.NewMiMC(), 4).Root(), tree.Root())
+	assert.Empty(t, tree.leaves)
+	assert.Empty(t, tree.nodes[0])
+}
+
+func TestLargeTree(t *testing.T) {
+	hFunc := mimc.NewMiMC()
+	tree := New(mimc.NewMiMC(), 20)
+
+	indexes := []uint64{0, 1, 12345, 1<<20 - 1}
+	for _, i := range indexes {
+		assert.NoError(t, tree.Set(i, leafData(i)))
+	}
+	for _, i := range indexes {
+		proof, err := tree.Prove(i)
+		assert.NoError(t, err)
+		assert.Len(t, proof, 21)
+		assert.Equal(t, leafData(i), proof[0])
+		assert.True(t, merkletree.VerifyProof(hFunc, tree.Root(), proof, i, tree.NbLeaves()))
+	}
+
+	assert.Error(t, tree.Set(1<<20, leafData(0)))
+	_, err := tree.Prove(1 << 20)
+	assert.Error(t, err)
+}
+
+func TestEncoding(t *testing.T) {
+	tree := New(mimc.NewMiMC(), 4)
+	for i := uint64(0); i < 16; i += 3 {
+		assert.NoError(t, tree.Set(i, leafData(i)))
+	}
+
+	var buf bytes.Buffer
+	n, err := tree.WriteTo(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(buf.Len()), n)
+	encoded := append([]byte{}, buf.Bytes()...)
+
+	decoded := New(mimc.NewMiMC(), 4)
+	_, err = decoded.ReadFrom(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, tree.Root(), decoded.Root())
+	for i := uint64(0); i < 16; i++ {
+		expected, _ := tree.Prove(i)
+		proof, _ := decoded.Prove(i)
+		assert.Equal(t, expected, proof)
+	}
+
+	// other depth
+	_, err = New(mimc.NewMiMC(), 5).ReadFrom(bytes.NewReader(encoded))
+	assert.ErrorIs(t, err, ErrInvalidEncoding)
+
+	// nodes which aren't the hashes of the leaves: the first node of level 1
+	// (after the depth, the 6 leaves & the 6 leaf nodes) and the root
+	for _, offset := range []int{8 + 8 + 6*40 + 8 + 6*40 + 8 + 8, len(encoded) - 1} {
+		corrupted := append([]byte{}, encoded...)
+		corrupted[offset] ^= 1
+		_, err = New(mimc.NewMiMC(), 4).ReadFrom(bytes.NewReader(corrupted))
+		assert.ErrorIs(t, err, ErrInvalidEncoding, offset)
+	}
+}
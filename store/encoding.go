@@ -0,0 +1,57 @@
+package store
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+var errShortBuffer = errors.New("short buffer")
+
+// big endian encoding of the records, byte slices are prefixed with their length
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) uint64(v uint64) {
+	e.buf = binary.BigEndian.AppendUint64(e.buf, v)
+}
+
+func (e *encoder) bytes(b []byte) {
+	e.uint64(uint64(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) uint64() uint64 {
+	if d.err != nil || len(d.buf) < 8 {
+		d.err = errShortBuffer
+		return 0
+	}
+	v := binary.BigEndian.Uint64(d.buf)
+	d.buf = d.buf[8:]
+	return v
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.uint64()
+	if d.err != nil || uint64(len(d.buf)) < n {
+		d.err = errShortBuffer
+		return nil
+	}
+	b := make([]byte, n)
+	copy(b, d.buf)
+	d.buf = d.buf[n:]
+	return b
+}
+
+// all the bytes should be decoded
+func (d *decoder) finish() error {
+	if d.err == nil && len(d.buf) != 0 {
+		d.err = errors.New("trailing bytes")
+	}
+	return d.err
+}
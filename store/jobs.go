@@ -0,0 +1,109 @@
+package store
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// witness jobs of the sealed batches which are not proven yet, a file per batch in JobsDir.
+// A job is saved before its batch is committed and removed once the proof of the batch is saved,
+// so the batches committed but not proven before a crash are proven again when the node is reopened
+const JobsDir = "jobs"
+
+func jobFile(number uint64) string {
+	return "batch-" + strconv.FormatUint(number, 10)
+}
+
+// save the witness job of the batch, before the batch is committed
+func (s *Store) PutJob(number uint64, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.readOnly {
+		return ErrReadOnly
+	}
+	dir := filepath.Join(s.dir, JobsDir)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	return writeFileAtomic(dir, jobFile(number), append(s.header(), encodeRecord(data)...))
+}
+
+// witness job of the batch
+func (s *Store) Job(number uint64) ([]byte, error) {
+	path := filepath.Join(s.dir, JobsDir, jobFile(number))
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("job of batch-%d: %w", number, ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	header := s.header()
+	if len(data) < len(header) || !bytes.Equal(data[:len(header)], header) {
+		return nil, fmt.Errorf("%s: %w", path, ErrParamsMismatch)
+	}
+	record, err := decodeRecord(data[len(header):])
+	if err != nil || len(data) != len(header)+recordHeaderSize+len(record) {
+		return nil, fmt.Errorf("%s: %w", path, ErrCorrupted)
+	}
+	return record, nil
+}
+
+// numbers of the committed batches which have a job but no proof, in order.
+// Jobs of batches which were not committed (crash before the commit) or already proven are removed
+func (s *Store) PendingJobs() ([]uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dir := filepath.Join(s.dir, JobsDir)
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []uint64
+	for _, entry := range entries {
+		number, err := strconv.ParseUint(strings.TrimPrefix(entry.Name(), "batch-"), 10, 64)
+		if err != nil || entry.Name() != jobFile(number) {
+			// temp files of an interrupted write
+			continue
+		}
+		if _, proven := s.proofOf[number]; !proven && s.committed(number) {
+			pending = append(pending, number)
+			continue
+		}
+		if !s.readOnly {
+			if err := os.Remove(filepath.Join(dir, entry.Name())); err != nil {
+				return nil, err
+			}
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i] < pending[j] })
+	return pending, nil
+}
+
+// the batch is in the log
+func (s *Store) committed(number uint64) bool {
+	return len(s.log) != 0 && s.log[0].Number <= number && number <= s.lastBatch()
+}
+
+// remove the job of the proven batch
+func (s *Store) removeJob(number uint64) error {
+	err := os.Remove(filepath.Join(s.dir, JobsDir, jobFile(number)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
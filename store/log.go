@@ -0,0 +1,194 @@
+package store
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"os"
+)
+
+// records of the log files, a record is written with a single write & synced
+//
+//	length ∥ crc32(payload) ∥ payload
+const recordHeaderSize = 8
+
+// max size of a record, a larger length is a corrupted header
+const maxRecordSize = 1 << 30
+
+var (
+	// incomplete last record of a file, from a crash in the middle of its write
+	errTornRecord = errors.New("torn record")
+	// record followed by other records whose checksum doesn't match
+	errCorruptedRecord = errors.New("corrupted record")
+)
+
+// append-only file of records, starting with the config hash
+type logFile struct {
+	f *os.File
+}
+
+// open the log at path & read its records. A torn record at the end of the file
+// (crash in the middle of an append) is truncated, so the log holds the committed records only.
+// A corrupted record in the middle of the file fails with ErrCorrupted, the file is left as is
+func openLog(path string, header []byte) (*logFile, [][]byte, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	records, size, err := readLog(f, header)
+	if err != nil {
+		f.Close()
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	if err := f.Truncate(size); err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	if _, err := f.Seek(size, io.SeekStart); err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	if size == 0 {
+		if _, err := f.Write(header); err != nil {
+			f.Close()
+			return nil, nil, err
+		}
+		if err := f.Sync(); err != nil {
+			f.Close()
+			return nil, nil, err
+		}
+	}
+
+	return &logFile{f: f}, records, nil
+}
+
+// committed records of the log at path, the file is left as is
+func readLogFile(path string, header []byte) ([][]byte, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	records, _, err := readLog(f, header)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return records, nil
+}
+
+// records of the log and the size of the committed part of the file
+func readLog(r io.Reader, header []byte) ([][]byte, int64, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(data) == 0 {
+		return nil, 0, nil
+	}
+	if len(data) < len(header) {
+		// crash before the header was synced
+		return nil, 0, nil
+	}
+	if !bytes.Equal(data[:len(header)], header) {
+		return nil, 0, ErrParamsMismatch
+	}
+
+	var records [][]byte
+	offset := len(header)
+	for offset < len(data) {
+		record, err := decodeRecord(data[offset:])
+		if errors.Is(err, errTornRecord) {
+			break
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("%w: %s at offset %d", ErrCorrupted, err, offset)
+		}
+		records = append(records, record)
+		offset += recordHeaderSize + len(record)
+	}
+
+	return records, int64(offset), nil
+}
+
+// append the record & sync it, the record is committed once Append returns
+func (l *logFile) Append(payload []byte) error {
+	if l == nil {
+		return ErrReadOnly
+	}
+	if _, err := l.f.Write(encodeRecord(payload)); err != nil {
+		return err
+	}
+	return l.f.Sync()
+}
+
+func (l *logFile) Close() error {
+	if l == nil {
+		return nil
+	}
+	return l.f.Close()
+}
+
+func encodeRecord(payload []byte) []byte {
+	record := make([]byte, recordHeaderSize, recordHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(payload))
+	return append(record, payload...)
+}
+
+// payload of the record at the start of data, data runs to the end of the file.
+// Only the last record of the file can be torn: it's incomplete, or its checksum doesn't match
+// and it ends the file. A checksum mismatch before the end of the file is a corrupted record,
+// and so is a record running to the end of the file with a complete record after its header
+// (its length is corrupted, the records after it were committed)
+func decodeRecord(data []byte) ([]byte, error) {
+	if len(data) < recordHeaderSize {
+		return nil, errTornRecord
+	}
+	length := binary.BigEndian.Uint32(data[0:4])
+	if length > maxRecordSize {
+		return nil, errCorruptedRecord
+	}
+	if uint64(len(data)-recordHeaderSize) < uint64(length) {
+		return nil, lastRecord(data)
+	}
+	end := recordHeaderSize + int(length)
+	payload := data[recordHeaderSize:end]
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(data[4:8]) {
+		if end == len(data) {
+			return nil, lastRecord(data)
+		}
+		return nil, errCorruptedRecord
+	}
+	return payload, nil
+}
+
+// error of the invalid record running to the end of the file: torn, unless a complete record
+// starts after its header
+func lastRecord(data []byte) error {
+	for offset := recordHeaderSize; offset+recordHeaderSize < len(data); offset++ {
+		if isRecord(data[offset:]) {
+			return errCorruptedRecord
+		}
+	}
+	return errTornRecord
+}
+
+// data starts with a complete, non-empty record
+func isRecord(data []byte) bool {
+	length := binary.BigEndian.Uint32(data[0:4])
+	if length == 0 || uint64(len(data)-recordHeaderSize) < uint64(length) {
+		return false
+	}
+	payload := data[recordHeaderSize : recordHeaderSize+int(length)]
+	return crc32.ChecksumIEEE(payload) == binary.BigEndian.Uint32(data[4:8])
+}
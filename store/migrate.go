@@ -0,0 +1,129 @@
+package store
+
+import (
+	"ZK-Rollup/account"
+	"ZK-Rollup/config"
+	"ZK-Rollup/stateTree"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr/mimc"
+)
+
+// header of the files of a store: config hash ∥ version of the account encoding
+func header(cfg config.Config, version account.Version) []byte {
+	return append(cfg.Hash(), byte(version))
+}
+
+func (s *Store) header() []byte {
+	return header(s.cfg, s.codec.Version)
+}
+
+// version of the account encoding of the store in dir, read from the header of its checkpoint
+// (of its batches log if there is no checkpoint yet). ok is false for a new store
+func storeVersion(dir string, cfg config.Config) (account.Version, bool, error) {
+	for _, name := range []string{CheckpointFile, BatchesFile} {
+		path := filepath.Join(dir, name)
+		f, err := os.Open(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return 0, false, err
+		}
+		h := make([]byte, len(cfg.Hash())+1)
+		_, err = io.ReadFull(f, h)
+		f.Close()
+		if err != nil {
+			// log of a new store, or a truncated file refused when it's read
+			continue
+		}
+		if !bytes.Equal(h[:len(h)-1], cfg.Hash()) {
+			return 0, false, fmt.Errorf("%s: %w", path, ErrParamsMismatch)
+		}
+		return account.Version(h[len(h)-1]), true, nil
+	}
+	return 0, false, nil
+}
+
+// migrates the store in dir from the account encoding of the version to account.Current.
+// The state root depends on the encoding, so the batches of the store can't be replayed on top of
+// the migrated accounts: the files of the store are moved into dir/v<version>, and the store restarts
+// at its last committed batch with the migrated state, as a store created from a snapshot.
+// The checkpoint is replaced last, so the migration is run again after a crash
+func migrate(dir string, cfg config.Config, version account.Version) error {
+	codec, err := account.CodecOf(version)
+	if err != nil {
+		return err
+	}
+	backup := filepath.Join(dir, fmt.Sprintf("v%d", version))
+	if err := os.MkdirAll(backup, 0o755); err != nil {
+		return err
+	}
+	for _, name := range []string{BaseFile, BatchesFile, ProofsFile, JobsDir} {
+		// already moved by an interrupted migration, the file in dir is a migrated one
+		if _, err := os.Stat(filepath.Join(backup, name)); err == nil {
+			if err := os.RemoveAll(filepath.Join(dir, name)); err != nil {
+				return err
+			}
+			continue
+		}
+		err := os.Rename(filepath.Join(dir, name), filepath.Join(backup, name))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	data, err := os.ReadFile(filepath.Join(dir, CheckpointFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		// no state saved yet
+		return syncDir(dir)
+	}
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(backup, CheckpointFile, data); err != nil {
+		return err
+	}
+
+	old, err := openReadOnly(backup, cfg, codec)
+	if err != nil {
+		return err
+	}
+	state, err := old.Recover()
+	if err != nil {
+		return err
+	}
+	accounts, err := account.Migrate(state.Accounts, version)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrCorrupted, err)
+	}
+
+	migrated := State{
+		BatchNumber: state.BatchNumber,
+		Accounts:    accounts,
+		Tree:        stateTree.New(mimc.NewMiMC(), cfg.TreeDepth()),
+	}
+	hFunc := mimc.NewMiMC()
+	size := account.Current.Size()
+	for i := 0; i*size < len(accounts); i++ {
+		hFunc.Reset()
+		hFunc.Write(accounts[i*size : (i+1)*size])
+		if err := migrated.Tree.Set(uint64(i), hFunc.Sum(nil)); err != nil {
+			return err
+		}
+	}
+
+	s := &Store{dir: dir, cfg: cfg, codec: account.Current}
+	if err := s.Checkpoint(migrated); err != nil {
+		return err
+	}
+	slog.Info(fmt.Sprintf("accounts of %s migrated from version %d at batch-%d, the previous store is in %s",
+		dir, version, migrated.BatchNumber, backup))
+	return nil
+}
@@ -0,0 +1,507 @@
+package store
+
+import (
+	"ZK-Rollup/account"
+	"ZK-Rollup/config"
+	"ZK-Rollup/stateTree"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr/mimc"
+	groth16 "github.com/consensys/gnark/backend/groth16"
+)
+
+// Durable state of the execution node, in append-only files of dir
+//
+//	checkpoint: accounts & tree nodes after a batch, replaced atomically
+//	base:       first checkpoint of the store (genesis or snapshot)
+//	batches:    write-ahead log of the sealed batches, the accounts updated by every batch
+//	proofs:     proofs of the batches
+//	jobs:       witness jobs of the batches not proven yet
+//
+// A batch is committed once its record is synced into the batches log. After a crash the state is
+// recovered from the checkpoint and the batches committed after it, at the last committed batch.
+// Every file starts with the config hash, a store of another rollup shape is refused,
+// and the version of the account encoding (a store of an older version is migrated, see migrate).
+type Store struct {
+	dir      string
+	cfg      config.Config
+	codec    account.Codec // encoding of the accounts of the store
+	readOnly bool
+
+	mu      sync.Mutex
+	batches *logFile
+	proofs  *logFile
+	log     []Batch           // committed batches, in order
+	proofOf map[uint64][]byte // serialized proof by batch number
+}
+
+const (
+	CheckpointFile = "checkpoint"
+	BaseFile       = "base" // first checkpoint, kept to rebuild the state of any batch
+	BatchesFile    = "batches"
+	ProofsFile     = "proofs"
+)
+
+var (
+	ErrParamsMismatch = errors.New("store params mismatch")
+	ErrEmpty          = errors.New("empty store")
+	ErrNotFound       = errors.New("not found")
+	ErrCorrupted      = errors.New("corrupted store")
+	ErrBatchOrder     = errors.New("batch out of order")
+	ErrReadOnly       = errors.New("store opened read-only")
+	ErrOldVersion     = errors.New("store of an older account encoding")
+)
+
+// accounts updated by a batch
+type AccountUpdate struct {
+	Index uint64
+	Bytes []byte
+}
+
+// record of a sealed batch
+type Batch struct {
+	Number     uint64
+	RootBefore []byte
+	RootAfter  []byte
+	NbAccounts uint64          // number of accounts after the batch
+	Updates    []AccountUpdate // accounts updated by the batch, after the batch
+
+	PublicWitness []byte // binary public witness of the proof of the batch: roots, deposits, withdrawals & batch number
+}
+
+// state after a batch
+type State struct {
+	BatchNumber uint64
+	Accounts    []byte // account bytes appended
+	Tree        *stateTree.Tree
+}
+
+func (s *State) Root() []byte {
+	return s.Tree.Root()
+}
+
+// open the store in dir, created if it doesn't exist.
+// Torn records at the end of the logs, from a crash in the middle of a write, are dropped.
+// The accounts of a store of an older encoding are migrated to account.Current
+func Open(dir string, cfg config.Config) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	version, ok, err := storeVersion(dir, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if ok && version != account.Current.Version {
+		if err := migrate(dir, cfg, version); err != nil {
+			return nil, fmt.Errorf("migration of the accounts from version %d: %w", version, err)
+		}
+	}
+
+	return open(dir, cfg, account.Current)
+}
+
+func open(dir string, cfg config.Config, codec account.Codec) (*Store, error) {
+	s := &Store{dir: dir, cfg: cfg, codec: codec}
+	batches, batchRecords, err := openLog(filepath.Join(dir, BatchesFile), s.header())
+	if err != nil {
+		return nil, err
+	}
+	s.batches = batches
+	proofs, proofRecords, err := openLog(filepath.Join(dir, ProofsFile), s.header())
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	s.proofs = proofs
+
+	if err := s.load(batchRecords, proofRecords); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// open the store in dir without writing to it, the committed batches & proofs are read
+// while the store can be written by a running node. Commits & checkpoints fail with ErrReadOnly.
+// A store of an older account encoding fails with ErrOldVersion, it's migrated by Open
+func OpenReadOnly(dir string, cfg config.Config) (*Store, error) {
+	version, ok, err := storeVersion(dir, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if ok && version != account.Current.Version {
+		return nil, fmt.Errorf("%s: %w: accounts of version %d", dir, ErrOldVersion, version)
+	}
+	return openReadOnly(dir, cfg, account.Current)
+}
+
+func openReadOnly(dir string, cfg config.Config, codec account.Codec) (*Store, error) {
+	s := &Store{dir: dir, cfg: cfg, codec: codec, readOnly: true}
+	batchRecords, err := readLogFile(filepath.Join(dir, BatchesFile), s.header())
+	if err != nil {
+		return nil, err
+	}
+	proofRecords, err := readLogFile(filepath.Join(dir, ProofsFile), s.header())
+	if err != nil {
+		return nil, err
+	}
+	return s, s.load(batchRecords, proofRecords)
+}
+
+func (s *Store) load(batchRecords, proofRecords [][]byte) error {
+	s.proofOf = make(map[uint64][]byte)
+	for _, record := range batchRecords {
+		b, err := decodeBatch(record)
+		if err != nil {
+			return fmt.Errorf("%s: %w: %s", BatchesFile, ErrCorrupted, err)
+		}
+		s.log = append(s.log, b)
+	}
+	for _, record := range proofRecords {
+		d := decoder{buf: record}
+		number, proof := d.uint64(), d.bytes()
+		if err := d.finish(); err != nil {
+			return fmt.Errorf("%s: %w: %s", ProofsFile, ErrCorrupted, err)
+		}
+		s.proofOf[number] = proof
+	}
+	return nil
+}
+
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return errors.Join(s.batches.Close(), s.proofs.Close())
+}
+
+// state at the last committed batch: the checkpoint with the batches committed after it.
+// The root after every replayed batch should be the root of its record.
+// Fails with ErrEmpty if no state was saved
+func (s *Store) Recover() (State, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, err := s.readState(CheckpointFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		if len(s.log) != 0 {
+			return State{}, fmt.Errorf("%w: batches without checkpoint", ErrCorrupted)
+		}
+		return State{}, ErrEmpty
+	}
+	if err != nil {
+		return State{}, err
+	}
+
+	return state, s.replay(&state, s.lastBatch())
+}
+
+// state after the committed batch, replayed from the last checkpoint before it,
+// or from the first checkpoint of the store
+func (s *Store) StateAt(number uint64) (State, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, err := s.readState(CheckpointFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return State{}, ErrEmpty
+	}
+	if err == nil && state.BatchNumber > number {
+		state, err = s.readState(BaseFile)
+	}
+	if err != nil {
+		return State{}, err
+	}
+	if state.BatchNumber > number {
+		return State{}, fmt.Errorf("state of batch-%d: %w", number, ErrNotFound)
+	}
+
+	if err := s.replay(&state, number); err != nil {
+		return State{}, err
+	}
+	if state.BatchNumber != number {
+		return State{}, fmt.Errorf("state of batch-%d: %w", number, ErrNotFound)
+	}
+	return state, nil
+}
+
+// replay the committed batches after the state, up to the batch number
+func (s *Store) replay(state *State, number uint64) error {
+	for _, b := range s.log {
+		if b.Number <= state.BatchNumber || b.Number > number {
+			continue
+		}
+		if b.Number != state.BatchNumber+1 || !bytes.Equal(b.RootBefore, state.Root()) {
+			return fmt.Errorf("%w: batch-%d doesn't follow batch-%d", ErrCorrupted, b.Number, state.BatchNumber)
+		}
+		if err := replay(state, b, s.codec.Size()); err != nil {
+			return fmt.Errorf("%w: batch-%d: %s", ErrCorrupted, b.Number, err)
+		}
+		if !bytes.Equal(b.RootAfter, state.Root()) {
+			return fmt.Errorf("%w: batch-%d root mismatch", ErrCorrupted, b.Number)
+		}
+	}
+	return nil
+}
+
+// apply the account updates of the batch to the state
+func replay(state *State, b Batch, accountSize int) error {
+	hFunc := mimc.NewMiMC()
+	size := uint64(accountSize)
+	nbAccounts := uint64(len(state.Accounts)) / size
+	if b.NbAccounts > state.Tree.NbLeaves() {
+		return fmt.Errorf("%d accounts", b.NbAccounts)
+	}
+
+	// accounts removed from the state, their leaves are empty again
+	for i := b.NbAccounts; i < nbAccounts; i++ {
+		if err := state.Tree.Set(i, make([]byte, hFunc.Size())); err != nil {
+			return err
+		}
+	}
+	accounts := make([]byte, b.NbAccounts*size)
+	copy(accounts, state.Accounts)
+	state.Accounts = accounts
+
+	for _, u := range b.Updates {
+		if u.Index >= b.NbAccounts || uint64(len(u.Bytes)) != size {
+			return fmt.Errorf("invalid update of account-%d", u.Index)
+		}
+		copy(state.Accounts[u.Index*size:], u.Bytes)
+
+		hFunc.Reset()
+		hFunc.Write(u.Bytes)
+		if err := state.Tree.Set(u.Index, hFunc.Sum(nil)); err != nil {
+			return err
+		}
+	}
+
+	state.BatchNumber = b.Number
+	return nil
+}
+
+// append the batch to the log, the batch is committed once CommitBatch returns.
+// batches are committed in order
+func (s *Store) CommitBatch(b Batch) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if last := s.lastBatch(); len(s.log) != 0 && b.Number != last+1 {
+		return fmt.Errorf("%w: batch-%d after batch-%d", ErrBatchOrder, b.Number, last)
+	}
+	if err := s.batches.Append(encodeBatch(b)); err != nil {
+		return err
+	}
+	s.log = append(s.log, b)
+	return nil
+}
+
+// number of the last committed batch, 0 if none
+func (s *Store) LastBatch() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastBatch()
+}
+
+func (s *Store) lastBatch() uint64 {
+	if len(s.log) == 0 {
+		return 0
+	}
+	return s.log[len(s.log)-1].Number
+}
+
+// committed batch by number
+func (s *Store) Batch(number uint64) (Batch, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, b := range s.log {
+		if b.Number == number {
+			return b, nil
+		}
+	}
+	return Batch{}, fmt.Errorf("batch-%d: %w", number, ErrNotFound)
+}
+
+// save the proof of the batch, its witness job is removed
+func (s *Store) PutProof(number uint64, proof groth16.Proof) error {
+	var buf bytes.Buffer
+	if _, err := proof.WriteTo(&buf); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var e encoder
+	e.uint64(number)
+	e.bytes(buf.Bytes())
+	if err := s.proofs.Append(e.buf); err != nil {
+		return err
+	}
+	s.proofOf[number] = buf.Bytes()
+
+	// the proof is saved even if its job can't be removed, the job is removed again when the store is reopened
+	if err := s.removeJob(number); err != nil {
+		return fmt.Errorf("job of batch-%d: %w", number, err)
+	}
+	return nil
+}
+
+// the proof of the batch is saved
+func (s *Store) HasProof(number uint64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.proofOf[number]
+	return ok
+}
+
+// proof of the batch
+func (s *Store) Proof(number uint64) (groth16.Proof, error) {
+	s.mu.Lock()
+	data, ok := s.proofOf[number]
+	s.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("proof of batch-%d: %w", number, ErrNotFound)
+	}
+
+	proof := groth16.NewProof(ecc.BN254)
+	if _, err := proof.ReadFrom(bytes.NewReader(data)); err != nil {
+		return nil, fmt.Errorf("proof of batch-%d: %w: %s", number, ErrCorrupted, err)
+	}
+	return proof, nil
+}
+
+// replace the checkpoint with the state, the batches up to the state are not replayed anymore.
+// The first checkpoint is also kept as the base of the store
+func (s *Store) Checkpoint(state State) error {
+	var tree bytes.Buffer
+	if _, err := state.Tree.WriteTo(&tree); err != nil {
+		return err
+	}
+	var e encoder
+	e.uint64(state.BatchNumber)
+	e.bytes(state.Accounts)
+	e.bytes(tree.Bytes())
+	data := append(s.header(), encodeRecord(e.buf)...)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.readOnly {
+		return ErrReadOnly
+	}
+	if _, err := os.Stat(filepath.Join(s.dir, BaseFile)); errors.Is(err, fs.ErrNotExist) {
+		if err := writeFileAtomic(s.dir, BaseFile, data); err != nil {
+			return err
+		}
+	}
+	return writeFileAtomic(s.dir, CheckpointFile, data)
+}
+
+// the file is written to a temp file and renamed, so a crash keeps the previous file
+func writeFileAtomic(dir, name string, data []byte) error {
+	path := filepath.Join(dir, name)
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// state of a checkpoint file
+func (s *Store) readState(name string) (State, error) {
+	path := filepath.Join(s.dir, name)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return State{}, err
+	}
+
+	header := s.header()
+	if len(data) < len(header) || !bytes.Equal(data[:len(header)], header) {
+		return State{}, fmt.Errorf("%s: %w", path, ErrParamsMismatch)
+	}
+	record, err := decodeRecord(data[len(header):])
+	if err != nil || len(data) != len(header)+recordHeaderSize+len(record) {
+		return State{}, fmt.Errorf("%s: %w", path, ErrCorrupted)
+	}
+
+	d := decoder{buf: record}
+	state := State{BatchNumber: d.uint64(), Accounts: d.bytes()}
+	treeBytes := d.bytes()
+	if err := d.finish(); err != nil {
+		return State{}, fmt.Errorf("%s: %w: %s", path, ErrCorrupted, err)
+	}
+	if len(state.Accounts)%s.codec.Size() != 0 {
+		return State{}, fmt.Errorf("%s: %w: invalid accounts", path, ErrCorrupted)
+	}
+
+	state.Tree = stateTree.New(mimc.NewMiMC(), s.cfg.TreeDepth())
+	if _, err := state.Tree.ReadFrom(bytes.NewReader(treeBytes)); err != nil {
+		return State{}, fmt.Errorf("%s: %w: %s", path, ErrCorrupted, err)
+	}
+	return state, nil
+}
+
+func encodeBatch(b Batch) []byte {
+	var e encoder
+	e.uint64(b.Number)
+	e.bytes(b.RootBefore)
+	e.bytes(b.RootAfter)
+	e.uint64(b.NbAccounts)
+	e.uint64(uint64(len(b.Updates)))
+	for _, u := range b.Updates {
+		e.uint64(u.Index)
+		e.bytes(u.Bytes)
+	}
+	e.bytes(b.PublicWitness)
+	return e.buf
+}
+
+func decodeBatch(record []byte) (Batch, error) {
+	d := decoder{buf: record}
+	b := Batch{
+		Number:     d.uint64(),
+		RootBefore: d.bytes(),
+		RootAfter:  d.bytes(),
+		NbAccounts: d.uint64(),
+	}
+	nbUpdates := d.uint64()
+	for i := uint64(0); i < nbUpdates && d.err == nil; i++ {
+		b.Updates = append(b.Updates, AccountUpdate{Index: d.uint64(), Bytes: d.bytes()})
+	}
+	b.PublicWitness = d.bytes()
+	return b, d.finish()
+}
+
+// sync the renamed files of the directory
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,288 @@
+package store
+
+import (
+	"ZK-Rollup/account"
+	"ZK-Rollup/config"
+	"ZK-Rollup/stateTree"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr/mimc"
+	groth16 "github.com/consensys/gnark/backend/groth16"
+	"github.com/stretchr/testify/assert"
+)
+
+var testConfig = config.Default()
+
+// genesis state with nbAccounts accounts
+func genesis(nbAccounts uint64) State {
+	state := State{Tree: stateTree.New(mimc.NewMiMC(), testConfig.TreeDepth())}
+	for i := uint64(0); i < nbAccounts; i++ {
+		acc := account.Account{Index: i, Nonce: i}
+		state.Accounts = append(state.Accounts, acc.Marshal()...)
+		setLeaf(state.Tree, i, acc.Marshal())
+	}
+	return state
+}
+
+func setLeaf(tree *stateTree.Tree, index uint64, accBytes []byte) {
+	hFunc := mimc.NewMiMC()
+	hFunc.Write(accBytes)
+	tree.Set(index, hFunc.Sum(nil))
+}
+
+// batch updating the nonce of the account, the state is updated with it
+func nextBatch(state *State, index uint64, nonce uint64) Batch {
+	acc := account.Account{Index: index, Nonce: nonce}
+	b := Batch{
+		Number:     state.BatchNumber + 1,
+		RootBefore: state.Root(),
+		NbAccounts: uint64(len(state.Accounts) / account.AccountSizeInBytes),
+		Updates:    []AccountUpdate{{Index: index, Bytes: acc.Marshal()}},
+		// not a witness, its bytes are stored as they are
+		PublicWitness: []byte{byte(nonce)},
+	}
+	copy(state.Accounts[index*uint64(account.AccountSizeInBytes):], acc.Marshal())
+	setLeaf(state.Tree, index, acc.Marshal())
+	b.RootAfter = state.Root()
+	state.BatchNumber = b.Number
+	return b
+}
+
+func TestRecover(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, testConfig)
+	assert.NoError(t, err)
+
+	_, err = s.Recover()
+	assert.ErrorIs(t, err, ErrEmpty)
+
+	state := genesis(4)
+	assert.NoError(t, s.Checkpoint(state))
+	assert.NoError(t, s.CommitBatch(nextBatch(&state, 1, 10)))
+	assert.NoError(t, s.CommitBatch(nextBatch(&state, 2, 20)))
+	_, err = s.Recover()
+	assert.NoError(t, err)
+	assert.NoError(t, s.Checkpoint(state))
+	assert.NoError(t, s.CommitBatch(nextBatch(&state, 1, 11)))
+	assert.ErrorIs(t, s.CommitBatch(Batch{Number: 5}), ErrBatchOrder)
+	assert.NoError(t, s.Close())
+
+	// crash in the middle of the next append
+	torn := encodeRecord(encodeBatch(nextBatch(&state, 3, 30)))
+	f, err := os.OpenFile(filepath.Join(dir, BatchesFile), os.O_APPEND|os.O_WRONLY, 0)
+	assert.NoError(t, err)
+	_, err = f.Write(torn[:len(torn)-3])
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+
+	s, err = Open(dir, testConfig)
+	assert.NoError(t, err)
+	defer s.Close()
+	assert.Equal(t, uint64(3), s.LastBatch())
+
+	recovered, err := s.Recover()
+	assert.NoError(t, err)
+	b, err := s.Batch(3)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3), recovered.BatchNumber)
+	assert.Equal(t, b.RootAfter, recovered.Root())
+	assert.Equal(t, []byte{11}, b.PublicWitness)
+
+	// the torn record is dropped, the next batch follows the last committed one
+	assert.NoError(t, s.CommitBatch(Batch{Number: 4, RootBefore: recovered.Root(), RootAfter: recovered.Root(), NbAccounts: 4}))
+	_, err = s.Batch(5)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestCorruptedLog(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, testConfig)
+	assert.NoError(t, err)
+
+	state := genesis(4)
+	assert.NoError(t, s.Checkpoint(state))
+	for i := uint64(1); i <= 3; i++ {
+		assert.NoError(t, s.CommitBatch(nextBatch(&state, i, 10*i)))
+	}
+	assert.NoError(t, s.Close())
+
+	path := filepath.Join(dir, BatchesFile)
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+
+	// a flipped byte in batch-1, the batches after it are kept in the file
+	corrupted := append([]byte{}, data...)
+	corrupted[len(header(testConfig, account.Current.Version))+recordHeaderSize] ^= 1
+	assert.NoError(t, os.WriteFile(path, corrupted, 0o644))
+	_, err = Open(dir, testConfig)
+	assert.ErrorIs(t, err, ErrCorrupted)
+	_, err = OpenReadOnly(dir, testConfig)
+	assert.ErrorIs(t, err, ErrCorrupted)
+	kept, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, corrupted, kept)
+
+	// a flipped length byte in batch-1, the record runs past the end of the file
+	corrupted = append([]byte{}, data...)
+	corrupted[len(header(testConfig, account.Current.Version))] ^= 1
+	assert.NoError(t, os.WriteFile(path, corrupted, 0o644))
+	_, err = Open(dir, testConfig)
+	assert.ErrorIs(t, err, ErrCorrupted)
+	kept, err = os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, corrupted, kept)
+
+	// the same flip in the last record is a torn append, only the last batch is dropped
+	corrupted = append([]byte{}, data...)
+	corrupted[len(corrupted)-1] ^= 1
+	assert.NoError(t, os.WriteFile(path, corrupted, 0o644))
+	s, err = Open(dir, testConfig)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), s.LastBatch())
+	assert.NoError(t, s.Close())
+
+	// as a length byte of the last record
+	assert.NoError(t, os.WriteFile(path, data, 0o644))
+	s, err = Open(dir, testConfig)
+	assert.NoError(t, err)
+	assert.NoError(t, s.CommitBatch(nextBatch(&state, 1, 40)))
+	assert.NoError(t, s.Close())
+	record := len(data)
+	data, err = os.ReadFile(path)
+	assert.NoError(t, err)
+	data[record] ^= 1
+	assert.NoError(t, os.WriteFile(path, data, 0o644))
+	s, err = Open(dir, testConfig)
+	assert.NoError(t, err)
+	defer s.Close()
+	assert.Equal(t, uint64(3), s.LastBatch())
+}
+
+func TestRecoverRootMismatch(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, testConfig)
+	assert.NoError(t, err)
+	defer s.Close()
+
+	state := genesis(4)
+	assert.NoError(t, s.Checkpoint(state))
+	b := nextBatch(&state, 1, 10)
+	b.RootAfter = bytes.Repeat([]byte{1}, len(b.RootAfter))
+	assert.NoError(t, s.CommitBatch(b))
+
+	_, err = s.Recover()
+	assert.ErrorIs(t, err, ErrCorrupted)
+}
+
+func TestParamsMismatch(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, testConfig)
+	assert.NoError(t, err)
+	assert.NoError(t, s.Close())
+
+	_, err = Open(dir, config.New(32, 4))
+	assert.ErrorIs(t, err, ErrParamsMismatch)
+}
+
+func TestProofs(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, testConfig)
+	assert.NoError(t, err)
+
+	proof := groth16.NewProof(ecc.BN254)
+	assert.NoError(t, s.PutProof(1, proof))
+	assert.NoError(t, s.Close())
+
+	s, err = Open(dir, testConfig)
+	assert.NoError(t, err)
+	defer s.Close()
+
+	res, err := s.Proof(1)
+	assert.NoError(t, err)
+	var expected, actual bytes.Buffer
+	proof.WriteTo(&expected)
+	res.WriteTo(&actual)
+	assert.Equal(t, expected.Bytes(), actual.Bytes())
+
+	_, err = s.Proof(2)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// the job of the proven batch can't be removed, the proof is saved anyway
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, JobsDir, jobFile(2), "x"), 0o755))
+	assert.Error(t, s.PutProof(2, proof))
+	assert.True(t, s.HasProof(2))
+}
+
+func TestMigrate(t *testing.T) {
+	v1, err := account.CodecOf(account.V1)
+	assert.NoError(t, err)
+	encode := func(acc account.Account) []byte {
+		b, err := v1.Encode(&acc)
+		assert.NoError(t, err)
+		return b
+	}
+
+	// store of version 1 accounts at batch-1
+	dir := t.TempDir()
+	s, err := open(dir, testConfig, v1)
+	assert.NoError(t, err)
+	state := State{Tree: stateTree.New(mimc.NewMiMC(), testConfig.TreeDepth())}
+	for i := uint64(0); i < 4; i++ {
+		acc := account.Account{Index: i}
+		acc.Balances[0].SetUint64(100 * i)
+		state.Accounts = append(state.Accounts, encode(acc)...)
+		setLeaf(state.Tree, i, encode(acc))
+	}
+	assert.NoError(t, s.Checkpoint(state))
+	updated := account.Account{Index: 1, Nonce: 1}
+	b := Batch{Number: 1, RootBefore: state.Root(), NbAccounts: 4, Updates: []AccountUpdate{{Index: 1, Bytes: encode(updated)}}}
+	assert.NoError(t, replay(&state, b, v1.Size()))
+	b.RootAfter = state.Root()
+	assert.NoError(t, s.CommitBatch(b))
+	assert.NoError(t, s.PutProof(1, groth16.NewProof(ecc.BN254)))
+	assert.NoError(t, s.Close())
+
+	_, err = OpenReadOnly(dir, testConfig)
+	assert.ErrorIs(t, err, ErrOldVersion)
+
+	// the store restarts at batch-1 with the migrated accounts, the previous one is kept in v1
+	expected, err := account.Migrate(state.Accounts, account.V1)
+	assert.NoError(t, err)
+	check := func() {
+		s, err := Open(dir, testConfig)
+		assert.NoError(t, err)
+		defer s.Close()
+		recovered, err := s.Recover()
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(1), recovered.BatchNumber)
+		assert.Equal(t, expected, recovered.Accounts)
+		var acc account.Account
+		assert.NoError(t, account.UnMarshal(&acc, recovered.Accounts[account.AccountSizeInBytes:2*account.AccountSizeInBytes]))
+		assert.Equal(t, updated, acc)
+		tree := stateTree.New(mimc.NewMiMC(), testConfig.TreeDepth())
+		for i := 0; i < 4; i++ {
+			setLeaf(tree, uint64(i), expected[i*account.AccountSizeInBytes:(i+1)*account.AccountSizeInBytes])
+		}
+		assert.Equal(t, tree.Root(), recovered.Root())
+	}
+	check()
+	previous, err := openReadOnly(filepath.Join(dir, "v1"), testConfig, v1)
+	assert.NoError(t, err)
+	_, err = previous.Batch(1)
+	assert.NoError(t, err)
+	assert.True(t, previous.HasProof(1))
+	check()
+
+	// interrupted after the base was migrated, the checkpoint is still of version 1
+	data, err := os.ReadFile(filepath.Join(dir, "v1", CheckpointFile))
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, CheckpointFile), data, 0o644))
+	check()
+	base, err := os.ReadFile(filepath.Join(dir, "v1", BaseFile))
+	assert.NoError(t, err)
+	assert.Equal(t, header(testConfig, account.V1), base[:len(header(testConfig, account.V1))])
+}